@@ -3,14 +3,14 @@ module github.com/devancy/full-text-search-engine
 go 1.22.0
 
 require (
+	github.com/chzyer/readline v1.5.1
 	github.com/kljensen/snowball v0.9.0
 	github.com/stretchr/testify v1.9.0
+	golang.org/x/text v0.21.0
 )
 
 require (
-	github.com/chzyer/readline v1.5.1 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/eiannone/keyboard v0.0.0-20220611211555-0d226195f203 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
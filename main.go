@@ -2,28 +2,55 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"text/tabwriter"
 	"time"
 
 	"github.com/chzyer/readline"
 	utils "github.com/devancy/full-text-search-engine/utils"
 )
 
+// suggestThreshold is the number of results below which a spelling correction is offered.
+const suggestThreshold = 3
+
+// maxCompletions is the number of candidates offered when Tab is pressed.
+const maxCompletions = 10
+
 // config holds the application configuration values derived from flags.
 type config struct {
 	dumpPath      string
 	useConcurrent bool
+	shards        int
 	maxResults    int
+	maxExpansions int
+	language      string
+	detectLang    bool
+	fold          bool
+	synonymsPath  string
+	stopwordsPath string
+	keepStopwords bool
+	memBudgetMB   int
+	timeout       time.Duration
 }
 
 func main() {
 	setupLogging()
-	cfg := parseFlags()
+	if len(os.Args) > 1 && os.Args[1] == "analyze" {
+		if err := runAnalyze(os.Args[2:]); err != nil {
+			log.Fatalf("Analyze error: %v", err)
+		}
+		return
+	}
+	cfg := parseFlags(flag.CommandLine, os.Args[1:])
 
 	log.Println("Running Full Text Search Engine")
 
@@ -32,12 +59,22 @@ func main() {
 		log.Fatalf("Initialization error: %v", err)
 	}
 
-	idx, err := createAndPopulateIndex(docs, cfg.useConcurrent)
+	opts, err := indexOptions(cfg)
+	if err != nil {
+		log.Fatalf("Initialization error: %v", err)
+	}
+
+	idx, err := createAndPopulateIndex(docs, cfg, opts...)
 	if err != nil {
 		log.Fatalf("Initialization error: %v", err)
 	}
 
-	if err := runInteractiveSearch(idx, docs, cfg); err != nil {
+	err = runInteractiveSearch(idx, cfg)
+	// Indexes spilling postings to disk remove their files
+	if closer, ok := idx.(io.Closer); ok {
+		closer.Close()
+	}
+	if err != nil {
 		log.Fatalf("Runtime error: %v", err)
 	}
 }
@@ -48,15 +85,248 @@ func setupLogging() {
 	log.SetPrefix("[Search Engine] ")
 }
 
-// parseFlags parses command-line flags and returns a config struct.
-func parseFlags() (cfg config) {
-	flag.StringVar(&cfg.dumpPath, "p", "enwiki-latest-abstract1.xml.gz", "wiki abstract dump path")
-	flag.BoolVar(&cfg.useConcurrent, "c", false, "use concurrent indexing")
-	flag.IntVar(&cfg.maxResults, "n", 5, "maximum number of results to display")
-	flag.Parse()
+// parseFlags parses command-line flags with fs and returns a config struct.
+func parseFlags(fs *flag.FlagSet, args []string) (cfg config) {
+	fs.StringVar(&cfg.dumpPath, "p", "enwiki-latest-abstract1.xml.gz", "wiki abstract dump path")
+	fs.BoolVar(&cfg.useConcurrent, "c", false, "use concurrent indexing")
+	fs.IntVar(&cfg.shards, "shards", 0, "split the index into this many shards indexed and searched in parallel, 0 for a single index")
+	fs.IntVar(&cfg.maxResults, "n", 5, "maximum number of results to display")
+	fs.IntVar(&cfg.maxExpansions, "x", utils.DefaultMaxExpansions, "maximum number of terms a prefix, wildcard, range or fuzzy query term may expand to")
+	fs.StringVar(&cfg.language, "lang", string(utils.English), "language of the dump, used for stemming and stopwords")
+	fs.BoolVar(&cfg.detectLang, "detect", false, "detect the language of each document and query, -lang being the fallback")
+	fs.BoolVar(&cfg.fold, "fold", false, "normalize Unicode and fold case and accents, so that zurich matches Zürich")
+	fs.StringVar(&cfg.synonymsPath, "synonyms", "", "synonyms file in the Solr format, expanded in queries")
+	fs.StringVar(&cfg.stopwordsPath, "stopwords", "", "stopword list replacing the one of -lang and of detected languages, one word per line")
+	fs.BoolVar(&cfg.keepStopwords, "keep-stopwords", false, "index stopwords for phrase queries such as \"the who\", ignoring them in other queries")
+	fs.IntVar(&cfg.memBudgetMB, "mem", 0, "memory budget in MB for the postings of the simple index, spilled to disk beyond it, 0 for no limit")
+	fs.DurationVar(&cfg.timeout, "timeout", 5*time.Second, "time after which a query stops and shows the results found so far, 0 for no limit")
+	fs.Parse(args)
 	return cfg
 }
 
+// indexOptions returns the index options derived from the configuration.
+// Titles are indexed as an additional field, analyzed in the language given by -lang.
+func indexOptions(cfg config) ([]utils.IndexOption, error) {
+	lang, err := utils.ParseLanguage(cfg.language)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -lang flag: %w (supported: %v)", err, utils.Languages())
+	}
+	var filters []utils.TokenFilter
+	if cfg.fold {
+		filters = []utils.TokenFilter{utils.NFKCFilter, utils.CaseFoldFilter, utils.ASCIIFoldingFilter}
+	}
+	stopwords, err := utils.LanguageStopwords(lang)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.stopwordsPath != "" {
+		if stopwords, err = utils.LoadStopwords(cfg.stopwordsPath); err != nil {
+			return nil, fmt.Errorf("invalid -stopwords flag: %w", err)
+		}
+	}
+
+	// Kept stopwords are indexed, so the analyzer must not remove them
+	removed := stopwords
+	if cfg.keepStopwords {
+		removed = nil
+	}
+	analyzer, err := utils.NewLanguageAnalyzerWithStopwords(lang, removed, filters...)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Using %s analyzer", lang)
+
+	// Detected languages follow the same stopword policy, with their own
+	// stopwords unless a custom list replaces them
+	langStopwords := func(lang utils.Language) utils.StopwordSet {
+		if cfg.keepStopwords {
+			return nil
+		}
+		if cfg.stopwordsPath != "" {
+			return stopwords
+		}
+		langStopwords, _ := utils.LanguageStopwords(lang)
+		return langStopwords
+	}
+	// Queries then ignore the kept stopwords of every language
+	if cfg.keepStopwords && cfg.detectLang && cfg.stopwordsPath == "" {
+		stopwords = anyStopwords(utils.Languages())
+	}
+
+	opts := []utils.IndexOption{
+		utils.WithAnalyzer(analyzer),
+		utils.WithField(utils.FieldTitle, analyzer),
+		utils.WithMaxExpansions(cfg.maxExpansions),
+	}
+	if cfg.keepStopwords {
+		opts = append(opts, utils.WithKeptStopwords(stopwords), utils.WithCommonGrams(stopwords))
+	}
+	if cfg.memBudgetMB > 0 {
+		opts = append(opts, utils.WithMemoryBudget(int64(cfg.memBudgetMB)<<20, ""))
+	}
+	if cfg.detectLang {
+		log.Printf("Detecting document and query languages")
+		opts = append(opts, utils.WithLanguageDetectionStopwords(nil, langStopwords, filters...), utils.WithQueryLanguageDetection())
+	}
+	if cfg.synonymsPath != "" {
+		synonyms, err := utils.LoadSynonyms(cfg.synonymsPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -synonyms flag: %w", err)
+		}
+		opts = append(opts, utils.WithSynonyms(synonyms, utils.SynonymsAtQuery))
+	}
+	return opts, nil
+}
+
+// anyStopwords returns the words that are stop words in any of langs.
+func anyStopwords(langs []utils.Language) utils.StopwordSet {
+	var sets []utils.StopwordSet
+	for _, lang := range langs {
+		if stopwords, err := utils.LanguageStopwords(lang); err == nil {
+			sets = append(sets, stopwords)
+		}
+	}
+	return stopwordSets(sets)
+}
+
+// stopwordSets is the union of stopword sets.
+type stopwordSets []utils.StopwordSet
+
+func (s stopwordSets) Contains(word string) bool {
+	for _, set := range s {
+		if set.Contains(word) {
+			return true
+		}
+	}
+	return false
+}
+
+// printExplanation prints how the score of the Nth result of the last query is
+// computed, N being given by arg as displayed in the results.
+func printExplanation(idx utils.Indexer, query string, results []utils.SearchResult, arg string) error {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return fmt.Errorf("usage: :explain N, N being the number of a result of the last query")
+	}
+	if n < 1 || n > len(results) {
+		return fmt.Errorf("no result %d for the last query (%d results)", n, len(results))
+	}
+	explanation, err := idx.Explain(query, results[n-1].DocID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nResult %d for %q:\n%s", n, query, explanation)
+	return nil
+}
+
+// runAnalyze implements the analyze subcommand: it prints how the analyzer configured
+// by the flags in args turns the remaining arguments into index terms, see analysisTarget.
+func runAnalyze(args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s analyze [flags] text...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	cfg := parseFlags(fs, args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no text to analyze")
+	}
+	opts, err := indexOptions(cfg)
+	if err != nil {
+		return err
+	}
+	a, text, err := analysisTarget(utils.NewIndex(opts...), strings.Join(fs.Args(), " "))
+	if err != nil {
+		return err
+	}
+	printAnalysis(os.Stdout, a, text)
+	return nil
+}
+
+// analysisTarget returns the analyzer selected by the argument of :analyze and the
+// text to analyze with it: "@lang text" selects the analyzer of a language, and
+// "field:text" that of queries on an indexed field. Other text is analyzed as a query.
+// Indexes that do not report their analyzers, see utils.AnalyzerLookup, analyze
+// all text as a query.
+func analysisTarget(idx utils.Indexer, arg string) (utils.Analyzer, string, error) {
+	arg = strings.TrimSpace(arg)
+	lookup, ok := idx.(utils.AnalyzerLookup)
+	if !ok {
+		return idx.Analyzer(), arg, nil
+	}
+	if rest, ok := strings.CutPrefix(arg, "@"); ok {
+		code, text, _ := strings.Cut(rest, " ")
+		lang, err := utils.ParseLanguage(code)
+		if err != nil {
+			return nil, "", err
+		}
+		a, ok := lookup.LanguageAnalyzer(lang)
+		if !ok {
+			return nil, "", fmt.Errorf("no %s analyzer, languages are only analyzed separately with -detect", lang)
+		}
+		return a, strings.TrimSpace(text), nil
+	}
+	if field, text, ok := strings.Cut(arg, ":"); ok && !strings.ContainsAny(field, " \t") {
+		if a, ok := lookup.FieldAnalyzer(field); ok {
+			return a, text, nil
+		}
+	}
+	return idx.Analyzer(), arg, nil
+}
+
+// printAnalysis prints the tokens of text after each step of a, with their
+// offsets in text, positions and position increments.
+func printAnalysis(w io.Writer, a utils.Analyzer, text string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, step := range utils.AnalyzeSteps(a, text) {
+		fmt.Fprintf(tw, "\n%s:\n", step.Name)
+		if len(step.Tokens) == 0 {
+			fmt.Fprintln(tw, "  (no tokens)")
+		}
+		for _, token := range step.Tokens {
+			fmt.Fprintf(tw, "  %q\t[%d:%d]\tpos %d\t+%d\t%s\n",
+				token.Term, token.Start, token.End, token.Position, token.PositionIncrement, token.Type)
+		}
+	}
+	tw.Flush()
+}
+
+// statsTopTerms is the number of most frequent terms printed by :stats.
+const statsTopTerms = 10
+
+// printStats prints the statistics of the index and its most frequent terms, or
+// those of the index terms of text if it is not empty.
+func printStats(w io.Writer, idx utils.Indexer, text string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	var terms []utils.TermStats
+	if text == "" {
+		stats := idx.Stats()
+		fmt.Fprintf(tw, "\nDocuments:\t%d\n", stats.DocumentCount)
+		fmt.Fprintf(tw, "Terms:\t%d\n", stats.TermCount)
+		fmt.Fprintf(tw, "Average document length:\t%.1f terms\n", stats.AvgDocLength)
+		fmt.Fprintf(tw, "Term scores:\t%.4f - %.4f\n", stats.MinScore, stats.MaxScore)
+		fmt.Fprintf(tw, "Index size:\t%d KB\n", stats.IndexSizeKB)
+		fmt.Fprintf(tw, "\nTop %d terms:\n", statsTopTerms)
+		terms = idx.TopTerms(statsTopTerms)
+	} else {
+		fmt.Fprintln(tw)
+		for _, term := range idx.Analyzer().Analyze(text) {
+			stats, ok := idx.TermStats(term)
+			if !ok {
+				fmt.Fprintf(tw, "  %q\tnot indexed\n", term)
+				continue
+			}
+			terms = append(terms, stats)
+		}
+	}
+	for _, stats := range terms {
+		fmt.Fprintf(tw, "  %q\t%d occurrences\tin %d documents\t%d bytes\n",
+			stats.Term, stats.TotalFreq, stats.DocFreq, stats.PostingBytes)
+	}
+	tw.Flush()
+}
+
 // loadDocuments loads documents from the specified path and validates the path.
 func loadDocuments(dumpPath string) ([]*utils.Document, error) {
 	if _, err := os.Stat(dumpPath); os.IsNotExist(err) {
@@ -73,26 +343,53 @@ func loadDocuments(dumpPath string) ([]*utils.Document, error) {
 	return docs, nil
 }
 
-// createAndPopulateIndex creates the appropriate indexer (concurrent or simple) and adds documents.
-func createAndPopulateIndex(docs []*utils.Document, useConcurrent bool) (utils.Indexer, error) {
+// createAndPopulateIndex creates the appropriate indexer (sharded, concurrent or simple) and adds documents.
+func createAndPopulateIndex(docs []*utils.Document, cfg config, opts ...utils.IndexOption) (utils.Indexer, error) {
 	start := time.Now()
 	var idx utils.Indexer
-	if useConcurrent {
-		idx = utils.NewConcurrentIndex()
+	if cfg.shards > 0 {
+		idx = utils.NewShardedIndex(cfg.shards, opts...)
+		log.Printf("Using sharded index with %d shards", cfg.shards)
+	} else if cfg.useConcurrent {
+		idx = utils.NewConcurrentIndex(opts...)
 		log.Println("Using concurrent index")
 	} else {
-		idx = utils.NewIndex()
+		idx = utils.NewIndex(opts...)
 		log.Println("Using simple index")
 	}
 
-	log.Println("Indexing documents...")
-	idx.Add(docs)
-	log.Printf("Indexed %d documents in %v", len(docs), time.Since(start))
+	// Ctrl+C stops indexing, searching the documents indexed so far
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	log.Println("Indexing documents (press Ctrl+C to stop early)...")
+	if err := idx.AddContext(ctx, docs); err != nil {
+		if ctx.Err() == nil {
+			return nil, fmt.Errorf("indexing failed: %w", err)
+		}
+		log.Printf("Indexing interrupted, continuing with %d of %d documents", documentCount(idx), len(docs))
+	}
+	log.Printf("Indexed %d documents in %v", documentCount(idx), time.Since(start))
+
+	// Statistics walk every posting, only worth it to report spills
+	if cfg.memBudgetMB > 0 {
+		if stats := idx.Stats(); stats.Spills > 0 {
+			log.Printf("Spilled postings to disk %d times, peak postings memory %d MB", stats.Spills, stats.PeakMemoryBytes>>20)
+		}
+	}
 	return idx, nil
 }
 
+// documentCount returns the number of documents in idx, from its statistics
+// if it does not count them otherwise, see utils.DocumentCounter.
+func documentCount(idx utils.Indexer) int {
+	if counter, ok := idx.(utils.DocumentCounter); ok {
+		return counter.DocumentCount()
+	}
+	return idx.Stats().DocumentCount
+}
+
 // runInteractiveSearch handles the main user interaction loop for searching.
-func runInteractiveSearch(idx utils.Indexer, docs []*utils.Document, cfg config) error {
+func runInteractiveSearch(idx utils.Indexer, cfg config) error {
 	// Set up readline config for interactive input
 	rl, err := readline.NewEx(&readline.Config{
 		Prompt:          "> ",
@@ -100,12 +397,20 @@ func runInteractiveSearch(idx utils.Indexer, docs []*utils.Document, cfg config)
 		InterruptPrompt: "^C\n",
 		EOFPrompt:       "exit\n",
 		HistoryLimit:    100,
+		AutoComplete:    &queryCompleter{idx: idx},
 	})
 	if err != nil {
 		return fmt.Errorf("failed to initialize readline: %w", err)
 	}
 	defer rl.Close()
 
+	// The spell checker is built on first use, as most queries never need it
+	var speller *utils.SpellChecker
+
+	// The last query and its results, for :explain
+	var lastQuery string
+	var lastResults []utils.SearchResult
+
 	for {
 		fmt.Println("\nEnter your search query (press Ctrl+C or type 'exit' to quit):")
 		line, err := rl.Readline()
@@ -125,14 +430,105 @@ func runInteractiveSearch(idx utils.Indexer, docs []*utils.Document, cfg config)
 		if queryString == "" {
 			continue
 		}
-		results := performSearch(idx, queryString)
+		if arg, ok := strings.CutPrefix(queryString, ":analyze"); ok {
+			a, text, err := analysisTarget(idx, arg)
+			if err != nil {
+				fmt.Printf("\n%v\n", err)
+				continue
+			}
+			printAnalysis(os.Stdout, a, text)
+			continue
+		}
+		if text, ok := strings.CutPrefix(queryString, ":stats"); ok {
+			printStats(os.Stdout, idx, strings.TrimSpace(text))
+			continue
+		}
+		if arg, ok := strings.CutPrefix(queryString, ":explain"); ok {
+			if err := printExplanation(idx, lastQuery, lastResults, strings.TrimSpace(arg)); err != nil {
+				fmt.Printf("\n%v\n", err)
+			}
+			continue
+		}
+		results, err := performSearch(idx, queryString, cfg.timeout)
+		if err != nil {
+			fmt.Printf("\nInvalid query: %v\n", err)
+			continue
+		}
+		if len(results) < suggestThreshold {
+			if speller == nil {
+				speller = buildSpellChecker(idx)
+			}
+			queryString, results = suggestCorrection(idx, speller, queryString, results, cfg.timeout)
+		}
 		fmt.Printf("\nSearch Results for: %q\n", queryString)
-		displayResults(results, docs, cfg.maxResults)
+		displayResults(idx, results, cfg.maxResults)
+		lastQuery, lastResults = queryString, results
 	}
 }
 
-// displayResults handles printing search results with pagination.
-func displayResults(results []utils.SearchResult, docs []*utils.Document, pageSize int) {
+// queryCompleter completes titles and terms in the search prompt.
+// It implements readline.AutoCompleter and builds its completer on the first Tab press.
+type queryCompleter struct {
+	once      sync.Once
+	idx       utils.Indexer
+	completer *utils.Completer
+}
+
+// Do returns the completions of the line up to the cursor, as suffixes of the typed text.
+func (qc *queryCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	qc.once.Do(func() {
+		var err error
+		if qc.completer, err = utils.NewIndexCompleter(qc.idx); err != nil {
+			log.Printf("Completion unavailable: %v", err)
+		}
+	})
+	if qc.completer == nil {
+		return nil, pos
+	}
+
+	typed := string(line[:pos])
+	var candidates [][]rune
+	for _, completion := range qc.completer.Complete(typed, maxCompletions) {
+		text := []rune(completion.Text)
+		// Titles match ignoring case, only offer those that extend the typed text
+		if len(text) < pos || !strings.EqualFold(string(text[:pos]), typed) {
+			continue
+		}
+		candidates = append(candidates, text[pos:])
+	}
+	return candidates, pos
+}
+
+// buildSpellChecker creates a spell checker from the index vocabulary.
+func buildSpellChecker(idx utils.Indexer) *utils.SpellChecker {
+	start := time.Now()
+	speller := utils.NewSpellChecker(idx.SurfaceForms(), idx.Analyzer())
+	log.Printf("Built spell checker in %v", time.Since(start))
+	return speller
+}
+
+// suggestCorrection offers a corrected query when it finds more results than the original.
+// If the original query found nothing, the corrected query and its results are returned instead.
+func suggestCorrection(idx utils.Indexer, speller *utils.SpellChecker, query string, results []utils.SearchResult, timeout time.Duration) (string, []utils.SearchResult) {
+	corrected, ok := speller.CorrectQuery(query)
+	if !ok {
+		return query, results
+	}
+	correctedResults, err := performSearch(idx, corrected, timeout)
+	if err != nil || len(correctedResults) <= len(results) {
+		return query, results
+	}
+	if len(results) == 0 {
+		fmt.Printf("\nNo matches for %q, showing results for %q instead.\n", query, corrected)
+		return corrected, correctedResults
+	}
+	fmt.Printf("\nDid you mean: %q?\n", corrected)
+	return query, results
+}
+
+// displayResults handles printing search results with pagination, reading the
+// documents of each page from the index.
+func displayResults(idx utils.Indexer, results []utils.SearchResult, pageSize int) {
 	if len(results) == 0 {
 		fmt.Println("No matches found.")
 		return
@@ -152,19 +548,21 @@ displayLoop:
 		}
 
 		// Print results for the current page
-		for i := startIndex; i < endIndex; i++ {
-			result := results[i]
-			// Ensure DocID is within bounds
-			if result.DocID >= 0 && result.DocID < len(docs) {
-				doc := docs[result.DocID]
-				fmt.Printf("\n%d. %s\n", i+1, doc.Title)
-				fmt.Printf("   Score: %.4f\n", result.Score)
-				fmt.Printf("   URL: %s\n", doc.URL)
-				fmt.Printf("   %s\n", doc.Text)
-				fmt.Println(strings.Repeat("-", 80))
-			} else {
-				log.Printf("Warning: Invalid DocID %d found in search results.", result.DocID)
-			}
+		ids := make([]int, 0, endIndex-startIndex)
+		for _, result := range results[startIndex:endIndex] {
+			ids = append(ids, result.DocID)
+		}
+		docs, err := idx.GetMany(ids)
+		if err != nil {
+			log.Printf("Warning: failed to read the documents of the results: %v", err)
+			return
+		}
+		for i, doc := range docs {
+			fmt.Printf("\n%d. %s\n", startIndex+i+1, doc.Title)
+			fmt.Printf("   Score: %.4f\n", results[startIndex+i].Score)
+			fmt.Printf("   URL: %s\n", doc.URL)
+			fmt.Printf("   %s\n", doc.Text)
+			fmt.Println(strings.Repeat("-", 80))
 		}
 
 		startIndex = endIndex
@@ -188,10 +586,24 @@ displayLoop:
 }
 
 // performSearch searches the index and returns all matching results sorted by relevance.
-func performSearch(idx utils.Indexer, query string) []utils.SearchResult {
+// A search taking longer than timeout, if positive, returns the results found so far.
+func performSearch(idx utils.Indexer, query string, timeout time.Duration) ([]utils.SearchResult, error) {
 	start := time.Now()
 	log.Printf("Searching for: %q", query)
-	results := idx.Search(query)
-	log.Printf("Search completed in %v, found %d results.", time.Since(start), len(results))
-	return results
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	resp, err := idx.SearchContext(ctx, query, utils.SearchOptions{AllowPartialResults: true})
+	if err != nil {
+		return nil, err
+	}
+	if resp.TimedOut {
+		log.Printf("Search timed out after %v, showing the %d results found so far.", time.Since(start), len(resp.Results))
+		return resp.Results, nil
+	}
+	log.Printf("Search completed in %v, found %d results.", time.Since(start), len(resp.Results))
+	return resp.Results, nil
 }
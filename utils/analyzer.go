@@ -0,0 +1,399 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Token is a unit of text produced by a Tokenizer and transformed by token filters.
+type Token struct {
+	Term  string // text of the token, after the filters applied so far
+	Start int    // byte offset of the token in the analyzed text
+	End   int    // byte offset following the token in the analyzed text
+
+	// Position is the index of the token in the token stream. Filters removing tokens
+	// keep the positions of the others, so removed stopwords leave gaps, and tokens
+	// added at the same position, such as synonyms, share it.
+	Position int
+
+	// PositionIncrement is the difference between the position of the token and the
+	// position of the token before it, or the position plus one for the first token:
+	// 0 for tokens stacked at the same position, more than 1 after removed tokens.
+	PositionIncrement int
+
+	Type TokenType // kind of text the token was made from
+}
+
+// TokenType classifies tokens by the tokenizer rule producing them.
+type TokenType int
+
+const (
+	// WordToken is a run of letters and numbers, or a bigram of a script written
+	// without spaces. Tokens not produced by EntityTokenizer are words.
+	WordToken TokenType = iota
+
+	// NumberToken is a number with decimal or thousands separators, such as "3.14"
+	NumberToken
+
+	// HyphenatedToken is words joined by hyphens, such as "e-mail"
+	HyphenatedToken
+
+	// SymbolToken is a word followed by symbols that are part of its name, such as "C++" or "C#"
+	SymbolToken
+
+	// URLToken is a web address, such as "https://go.dev/doc"
+	URLToken
+
+	// EmailToken is an email address, such as "user@example.com"
+	EmailToken
+)
+
+// String returns the name of the token type.
+func (t TokenType) String() string {
+	switch t {
+	case WordToken:
+		return "word"
+	case NumberToken:
+		return "number"
+	case HyphenatedToken:
+		return "hyphenated"
+	case SymbolToken:
+		return "symbol"
+	case URLToken:
+		return "url"
+	case EmailToken:
+		return "email"
+	}
+	return fmt.Sprintf("TokenType(%d)", int(t))
+}
+
+// Tokenizer splits text into tokens.
+type Tokenizer interface {
+	Tokenize(text string) []Token
+}
+
+// TokenizerFunc adapts an ordinary function to the Tokenizer interface.
+type TokenizerFunc func(text string) []Token
+
+// Tokenize calls f(text).
+func (f TokenizerFunc) Tokenize(text string) []Token {
+	return f(text)
+}
+
+// TokenFilter transforms a slice of tokens, e.g. to normalize or remove some of them.
+// Filters keep the offsets and positions of the tokens they keep.
+type TokenFilter interface {
+	Filter(tokens []Token) []Token
+}
+
+// TokenFilterFunc adapts an ordinary function to the TokenFilter interface.
+type TokenFilterFunc func(tokens []Token) []Token
+
+// Filter calls f(tokens).
+func (f TokenFilterFunc) Filter(tokens []Token) []Token {
+	return f(tokens)
+}
+
+// NewTermFilter returns a filter replacing the term of each token with f(term).
+func NewTermFilter(f func(term string) string) TokenFilter {
+	return TokenFilterFunc(func(tokens []Token) []Token {
+		return mapTerms(tokens, f)
+	})
+}
+
+// NamedFilter returns f, named name in the steps reported by AnalyzeSteps.
+func NamedFilter(name string, f TokenFilter) TokenFilter {
+	return namedFilter{name: name, TokenFilter: f}
+}
+
+type namedFilter struct {
+	name string
+	TokenFilter
+}
+
+func (f namedFilter) String() string {
+	return f.name
+}
+
+// NamedTokenizer returns t, named name in the steps reported by AnalyzeSteps.
+func NamedTokenizer(name string, t Tokenizer) Tokenizer {
+	return namedTokenizer{name: name, Tokenizer: t}
+}
+
+type namedTokenizer struct {
+	name string
+	Tokenizer
+}
+
+func (t namedTokenizer) String() string {
+	return t.name
+}
+
+// mapTerms returns a copy of tokens with f applied to their terms.
+func mapTerms(tokens []Token, f func(term string) string) []Token {
+	r := make([]Token, len(tokens))
+	for i, token := range tokens {
+		token.Term = f(token.Term)
+		r[i] = token
+	}
+	return r
+}
+
+// keepTokens returns the tokens for which keep returns true, updating their
+// position increments to account for the removed ones.
+func keepTokens(tokens []Token, keep func(token Token) bool) []Token {
+	r := make([]Token, 0, len(tokens))
+	for _, token := range tokens {
+		if keep(token) {
+			r = append(r, token)
+		}
+	}
+	setIncrements(r)
+	return r
+}
+
+// setIncrements sets the position increments of tokens from their positions.
+func setIncrements(tokens []Token) {
+	prev := -1
+	for i := range tokens {
+		tokens[i].PositionIncrement = tokens[i].Position - prev
+		prev = tokens[i].Position
+	}
+}
+
+// newTokens returns tokens of terms at consecutive positions, without offsets,
+// for terms not produced by a Tokenizer.
+func newTokens(terms []string) []Token {
+	r := make([]Token, len(terms))
+	for i, term := range terms {
+		r[i] = Token{Term: term, Position: i, PositionIncrement: 1}
+	}
+	return r
+}
+
+// tokenTerms returns the terms of tokens.
+func tokenTerms(tokens []Token) []string {
+	r := make([]string, len(tokens))
+	for i, token := range tokens {
+		r[i] = token.Term
+	}
+	return r
+}
+
+// Analyzer turns text into index terms.
+// An index uses the same analyzer for the documents it indexes and for queries.
+type Analyzer interface {
+	Analyze(text string) []string
+}
+
+// AnalyzerFunc adapts an ordinary function to the Analyzer interface.
+type AnalyzerFunc func(text string) []string
+
+// Analyze calls f(text).
+func (f AnalyzerFunc) Analyze(text string) []string {
+	return f(text)
+}
+
+// SurfaceAnalyzer is an Analyzer that can stop before its tokens are normalized
+// into index terms, e.g. before stemming. The index records these surface forms
+// for spelling suggestions, completion and fuzzy, prefix, wildcard and range queries.
+// Analyzers not implementing SurfaceAnalyzer use their index terms as surface forms.
+type SurfaceAnalyzer interface {
+	Analyzer
+
+	// AnalyzeSurface returns the tokens of text as users would type them
+	AnalyzeSurface(text string) []Token
+
+	// Normalize turns the terms of surface tokens into index terms
+	Normalize(tokens []Token) []Token
+}
+
+// Reusable building blocks for custom analyzers
+var (
+	// StandardTokenizer splits text on any character that is not a letter or a number.
+	// Scripts written without spaces, such as Chinese, Japanese or Thai, are split
+	// into overlapping bigrams.
+	StandardTokenizer Tokenizer = NamedTokenizer("standard tokenizer", TokenizerFunc(tokenize))
+
+	// EntityTokenizer is a StandardTokenizer keeping URLs, email addresses, numbers,
+	// hyphenated words and names such as "C++" as single tokens, see NewEntityTokenizer.
+	EntityTokenizer Tokenizer = NewEntityTokenizer(false)
+
+	// CharacterFilter trims non-alphanumeric characters from words and drops tokens
+	// shorter than 2 characters, except single ideographs
+	CharacterFilter TokenFilter = NamedFilter("character filter", TokenFilterFunc(characterFilter))
+
+	// LowercaseFilter converts tokens to lower case
+	LowercaseFilter TokenFilter = NamedFilter("lowercase", TokenFilterFunc(lowercaseFilter))
+
+	// NFKCFilter applies Unicode NFKC normalization, turning ligatures and
+	// full-width characters into their usual form
+	NFKCFilter TokenFilter = NamedFilter("NFKC", TokenFilterFunc(nfkcFilter))
+
+	// CaseFoldFilter applies Unicode full case folding, a more thorough LowercaseFilter
+	CaseFoldFilter TokenFilter = NamedFilter("case folding", TokenFilterFunc(caseFoldFilter))
+
+	// TurkicCaseFoldFilter is a CaseFoldFilter for Turkish and Azerbaijani, folding
+	// the dotless "I" to "ı" and the dotted "İ" to "i". It must run before any
+	// LowercaseFilter, which would turn "I" into "i".
+	TurkicCaseFoldFilter TokenFilter = NamedFilter("turkic case folding", TokenFilterFunc(turkicCaseFoldFilter))
+
+	// ASCIIFoldingFilter removes diacritics from Latin letters, e.g. "Zürich" becomes "Zurich"
+	ASCIIFoldingFilter TokenFilter = NamedFilter("ASCII folding", TokenFilterFunc(asciiFoldingFilter))
+
+	// EnglishStopwordFilter removes common English words
+	EnglishStopwordFilter TokenFilter = NamedFilter("english stopwords", TokenFilterFunc(stopwordFilter))
+
+	// EnglishStemmerFilter reduces English words to their stem using the Snowball stemmer
+	EnglishStemmerFilter TokenFilter = NamedFilter("english stemmer", TokenFilterFunc(stemmerFilter))
+)
+
+// ChainAnalyzer is an Analyzer running a tokenizer followed by a chain of token filters.
+// It is created with an AnalyzerBuilder.
+type ChainAnalyzer struct {
+	tokenizer   Tokenizer
+	filters     []TokenFilter // produce surface forms
+	termFilters []TokenFilter // turn surface forms into index terms
+}
+
+// Analyze returns the index terms of text.
+func (a *ChainAnalyzer) Analyze(text string) []string {
+	return tokenTerms(a.Normalize(a.AnalyzeSurface(text)))
+}
+
+// AnalyzeSurface tokenizes text and runs the filters added with AnalyzerBuilder.Filter.
+func (a *ChainAnalyzer) AnalyzeSurface(text string) []Token {
+	return applyFilters(a.tokenizer.Tokenize(text), a.filters)
+}
+
+// Normalize runs the filters added with AnalyzerBuilder.TermFilter.
+func (a *ChainAnalyzer) Normalize(tokens []Token) []Token {
+	return applyFilters(tokens, a.termFilters)
+}
+
+// AnalyzeSteps returns the tokens of text after the tokenizer and after each filter.
+func (a *ChainAnalyzer) AnalyzeSteps(text string) []AnalysisStep {
+	tokens := a.tokenizer.Tokenize(text)
+	steps := []AnalysisStep{{Name: stepName(a.tokenizer, "tokenizer"), Tokens: tokens}}
+	for i, filter := range append(a.filters[:len(a.filters):len(a.filters)], a.termFilters...) {
+		tokens = filter.Filter(tokens)
+		steps = append(steps, AnalysisStep{Name: stepName(filter, fmt.Sprintf("filter %d", i+1)), Tokens: tokens})
+	}
+	return steps
+}
+
+// stepName returns the name of a tokenizer or filter, or fallback if it has none.
+func stepName(v any, fallback string) string {
+	if s, ok := v.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fallback
+}
+
+// applyFilters runs tokens through filters in order.
+func applyFilters(tokens []Token, filters []TokenFilter) []Token {
+	for _, filter := range filters {
+		tokens = filter.Filter(tokens)
+	}
+	return tokens
+}
+
+// AnalyzerBuilder composes a tokenizer and token filters into a ChainAnalyzer.
+type AnalyzerBuilder struct {
+	analyzer ChainAnalyzer
+}
+
+// NewAnalyzerBuilder starts building an analyzer using tokenizer.
+func NewAnalyzerBuilder(tokenizer Tokenizer) *AnalyzerBuilder {
+	return &AnalyzerBuilder{analyzer: ChainAnalyzer{tokenizer: tokenizer}}
+}
+
+// Filter appends filters producing the surface forms of tokens, such as
+// lower-casing or stopword removal.
+func (b *AnalyzerBuilder) Filter(filters ...TokenFilter) *AnalyzerBuilder {
+	b.analyzer.filters = append(b.analyzer.filters, filters...)
+	return b
+}
+
+// TermFilter appends filters turning surface forms into index terms, such as stemming.
+// Term filters always run after the filters added with Filter.
+func (b *AnalyzerBuilder) TermFilter(filters ...TokenFilter) *AnalyzerBuilder {
+	b.analyzer.termFilters = append(b.analyzer.termFilters, filters...)
+	return b
+}
+
+// Build returns the analyzer. The builder may be reused afterwards.
+func (b *AnalyzerBuilder) Build() *ChainAnalyzer {
+	a := b.analyzer
+	a.filters = append([]TokenFilter(nil), a.filters...)
+	a.termFilters = append([]TokenFilter(nil), a.termFilters...)
+	return &a
+}
+
+// NewEnglishAnalyzer returns the default analyzer: it splits text on non-alphanumeric
+// characters, trims and lower-cases tokens, removes English stopwords and stems.
+func NewEnglishAnalyzer() *ChainAnalyzer {
+	return NewAnalyzerBuilder(StandardTokenizer).
+		Filter(CharacterFilter, LowercaseFilter, EnglishStopwordFilter).
+		TermFilter(EnglishStemmerFilter).
+		Build()
+}
+
+// KeywordAnalyzer indexes the whole text, trimmed and lower-cased, as a single term.
+var KeywordAnalyzer Analyzer = AnalyzerFunc(func(text string) []string {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" {
+		return nil
+	}
+	return []string{text}
+})
+
+// defaultAnalyzer is used by indexes created without WithAnalyzer.
+var defaultAnalyzer Analyzer = NewEnglishAnalyzer()
+
+// analyzeSurface returns the surface tokens of text using a.
+func analyzeSurface(a Analyzer, text string) []Token {
+	if sa, ok := a.(SurfaceAnalyzer); ok {
+		return sa.AnalyzeSurface(text)
+	}
+	return newTokens(a.Analyze(text))
+}
+
+// surfaceForms returns the surface forms of text using a.
+func surfaceForms(a Analyzer, text string) []string {
+	return tokenTerms(analyzeSurface(a, text))
+}
+
+// normalize turns surface tokens produced by a into index terms.
+func normalize(a Analyzer, tokens []Token) []Token {
+	if sa, ok := a.(SurfaceAnalyzer); ok {
+		return sa.Normalize(tokens)
+	}
+	return tokens
+}
+
+// normalizeTerms turns surface forms produced by a into index terms.
+func normalizeTerms(a Analyzer, forms []string) []string {
+	return tokenTerms(normalize(a, newTokens(forms)))
+}
+
+// AnalysisStep is the output of a step of an analyzer, see AnalyzeSteps.
+type AnalysisStep struct {
+	Name   string // name of the tokenizer or filter, see NamedFilter
+	Tokens []Token
+}
+
+// AnalyzeSteps analyzes text with a and returns the tokens after each step, to
+// understand why a query does or does not match. ChainAnalyzers report their tokenizer
+// and each of their filters. Other analyzers report their surface forms and index
+// terms if they implement SurfaceAnalyzer, and only their index terms otherwise.
+func AnalyzeSteps(a Analyzer, text string) []AnalysisStep {
+	switch a := a.(type) {
+	case interface{ AnalyzeSteps(string) []AnalysisStep }:
+		return a.AnalyzeSteps(text)
+	case SurfaceAnalyzer:
+		surface := a.AnalyzeSurface(text)
+		return []AnalysisStep{{Name: "surface", Tokens: surface}, {Name: "normalize", Tokens: a.Normalize(surface)}}
+	}
+	return []AnalysisStep{{Name: "analyze", Tokens: newTokens(a.Analyze(text))}}
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnglishAnalyzer(t *testing.T) {
+	a := NewEnglishAnalyzer()
+	assert.Equal(t, []string{"donut", "glass", "plate"}, a.Analyze("A donut on a glass plate."))
+	assert.Equal(t, []string{"donuts", "fishing"}, tokenTerms(a.AnalyzeSurface("The donuts, fishing")))
+	assert.Equal(t, []string{"donut", "fish"}, tokenTerms(a.Normalize(newTokens([]string{"donuts", "fishing"}))))
+}
+
+func TestTokenOffsets(t *testing.T) {
+	text := "The Cats, and the (HAT)!"
+	tokens := NewEnglishAnalyzer().Normalize(NewEnglishAnalyzer().AnalyzeSurface(text))
+
+	// Removed stop words leave gaps in positions
+	assert.Equal(t, []Token{
+		{Term: "cat", Start: 4, End: 8, Position: 1, PositionIncrement: 2},
+		{Term: "hat", Start: 19, End: 22, Position: 4, PositionIncrement: 3},
+	}, tokens)
+	assert.Equal(t, "Cats", text[tokens[0].Start:tokens[0].End])
+	assert.Equal(t, "HAT", text[tokens[1].Start:tokens[1].End])
+}
+
+func TestAnalyzerBuilder(t *testing.T) {
+	reverse := TokenFilterFunc(func(tokens []Token) []Token {
+		r := make([]Token, len(tokens))
+		for i, token := range tokens {
+			r[len(tokens)-1-i] = token
+		}
+		return r
+	})
+
+	b := NewAnalyzerBuilder(TokenizerFunc(func(text string) []Token {
+		return newTokens(strings.Fields(text))
+	})).Filter(LowercaseFilter)
+	lower := b.Build()
+	reversed := b.Filter(reverse).TermFilter(EnglishStemmerFilter).Build()
+
+	// Building again does not change previously built analyzers
+	assert.Equal(t, []string{"the", "cats,", "sat"}, lower.Analyze("The Cats, sat"))
+	assert.Equal(t, []string{"sat", "cats,", "the"}, tokenTerms(reversed.AnalyzeSurface("The Cats, sat")))
+	assert.Equal(t, []string{"sat", "cats,", "the"}, reversed.Analyze("The Cats, sat"))
+	assert.Equal(t, []string{"cat"}, reversed.Analyze("CATS"))
+}
+
+func TestIndexWithAnalyzer(t *testing.T) {
+	// Keep stopwords and skip stemming
+	analyzer := NewAnalyzerBuilder(StandardTokenizer).
+		Filter(LowercaseFilter).
+		Build()
+	docs := []*Document{
+		{ID: 1, Text: "The Who are an English rock band"},
+		{ID: 2, Text: "Who wrote the bands' songs?"},
+	}
+
+	for _, idx := range []Indexer{NewIndex(WithAnalyzer(analyzer)), NewConcurrentIndex(WithAnalyzer(analyzer))} {
+		idx.Add(docs)
+		assert.Equal(t, analyzer, idx.Analyzer())
+
+		// Queries are analyzed with the same analyzer
+		results := idx.Search("THE WHO")
+		assert.Len(t, results, 2)
+
+		results = idx.Search("band")
+		assert.Len(t, results, 1)
+		assert.Equal(t, 1, results[0].DocID)
+
+		assert.Equal(t, 1, idx.SurfaceForms()["bands"])
+		assert.Len(t, idx.Search("band*"), 2)
+	}
+}
+
+func TestFoldingAnalyzer(t *testing.T) {
+	analyzer, err := NewLanguageAnalyzer(English, NFKCFilter, CaseFoldFilter, ASCIIFoldingFilter)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"zurich", "cafe", "file"}, tokenTerms(analyzer.AnalyzeSurface("Zürich CAFÉ ﬁle")))
+
+	// Stop words are removed whether they match before or after folding
+	assert.Equal(t, []string{"file"}, analyzer.Analyze("ＴＨＥ ﬁle"))
+	french, err := NewLanguageAnalyzer(French, ASCIIFoldingFilter)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"paris"}, french.Analyze("Il a été à Paris"))
+
+	// Filters see tokens before they are lower-cased
+	turkish, err := NewLanguageAnalyzer(English, TurkicCaseFoldFilter)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ıstanbul", "istanbul"}, tokenTerms(turkish.AnalyzeSurface("ISTANBUL İstanbul")))
+
+	docs := []*Document{
+		{ID: 1, Text: "Zürich is the largest city in Switzerland"},
+		{ID: 2, Text: "A café serving coffee"},
+	}
+	for _, idx := range []Indexer{NewIndex(WithAnalyzer(analyzer)), NewConcurrentIndex(WithAnalyzer(analyzer))} {
+		idx.Add(docs)
+
+		results := idx.Search("Zurich")
+		assert.Len(t, results, 1)
+		assert.Equal(t, 1, results[0].DocID)
+
+		results = idx.Search("cafe")
+		assert.Len(t, results, 1)
+		assert.Equal(t, 2, results[0].DocID)
+		assert.Len(t, idx.Search("zür*"), 1)
+	}
+}
+
+func TestAnalyzeSteps(t *testing.T) {
+	steps := AnalyzeSteps(NewEnglishAnalyzer(), "The Cats!")
+	var names []string
+	for _, step := range steps {
+		names = append(names, step.Name)
+	}
+	assert.Equal(t, []string{"standard tokenizer", "character filter", "lowercase", "english stopwords", "english stemmer"}, names)
+	assert.Equal(t, []string{"The", "Cats"}, tokenTerms(steps[0].Tokens))
+	assert.Equal(t, []Token{{Term: "cat", Start: 4, End: 8, Position: 1, PositionIncrement: 2}}, steps[4].Tokens)
+
+	// Unnamed filters are numbered
+	a := NewAnalyzerBuilder(EntityTokenizer).Filter(LowercaseFilter, NewTermFilter(strings.ToUpper)).Build()
+	steps = AnalyzeSteps(a, "C++")
+	assert.Equal(t, "entity tokenizer", steps[0].Name)
+	assert.Equal(t, "filter 2", steps[2].Name)
+	assert.Equal(t, SymbolToken, steps[2].Tokens[0].Type)
+
+	steps = AnalyzeSteps(KeywordAnalyzer, " New York ")
+	assert.Equal(t, []AnalysisStep{{Name: "analyze", Tokens: newTokens([]string{"new york"})}}, steps)
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// wikipediaTitlePrefix is prepended to every title in Wikipedia abstract dumps.
+const wikipediaTitlePrefix = "Wikipedia: "
+
+// Completer suggests completions for partially typed queries, from the index
+// vocabulary ranked by document frequency and from document titles ranked by popularity.
+type Completer struct {
+	terms  *termDict
+	freqs  map[string]int // term -> document frequency
+	titles []titleEntry   // sorted by key
+}
+
+// titleEntry is a document title indexed for completion.
+type titleEntry struct {
+	key        string // lower-cased title used for prefix matching
+	title      string
+	popularity int
+}
+
+// Completion is a suggested completion of a query.
+type Completion struct {
+	Text   string // The completed query
+	Weight int    // Document frequency of a term, or popularity of a title
+	Title  bool   // Whether the completion is a document title
+}
+
+// completerBatch is the number of stored documents NewIndexCompleter reads at once.
+const completerBatch = 1024
+
+// NewCompleter creates a Completer from surface forms and their document frequencies,
+// as returned by Indexer.SurfaceForms, the analyzer that produced them and the titles of docs.
+//
+// Titles are ranked by popularity, estimated as the document frequency of the
+// rarest word in the title: a title whose every word is widely mentioned across
+// the corpus is more likely to be what the user is looking for.
+func NewCompleter(vocabulary map[string]int, analyzer Analyzer, docs []*Document) *Completer {
+	c := newCompleter(vocabulary)
+	for _, doc := range docs {
+		c.addTitle(doc.Title, analyzer)
+	}
+	c.sortTitles()
+	return c
+}
+
+// NewIndexCompleter creates a Completer like NewCompleter from the vocabulary,
+// analyzer and stored documents of idx, reading them in batches so that the
+// documents need not be kept once indexed.
+func NewIndexCompleter(idx Indexer) (*Completer, error) {
+	c := newCompleter(idx.SurfaceForms())
+	analyzer := idx.Analyzer()
+	for ids := idx.IDs(); len(ids) > 0; {
+		batch := ids[:min(len(ids), completerBatch)]
+		docs, err := idx.GetMany(batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			c.addTitle(doc.Title, analyzer)
+		}
+		ids = ids[len(batch):]
+	}
+	c.sortTitles()
+	return c, nil
+}
+
+// newCompleter creates a Completer of the terms of vocabulary, without titles.
+func newCompleter(vocabulary map[string]int) *Completer {
+	terms := make([]string, 0, len(vocabulary))
+	for term := range vocabulary {
+		terms = append(terms, term)
+	}
+	return &Completer{
+		terms: newTermDict(terms),
+		freqs: vocabulary,
+	}
+}
+
+// addTitle adds a document title, once stripped of the dump's title prefix.
+func (c *Completer) addTitle(title string, analyzer Analyzer) {
+	title = strings.TrimPrefix(title, wikipediaTitlePrefix)
+	if title == "" {
+		return
+	}
+	c.titles = append(c.titles, titleEntry{
+		key:        strings.ToLower(title),
+		title:      title,
+		popularity: titlePopularity(surfaceForms(analyzer, title), c.freqs),
+	})
+}
+
+// sortTitles sorts the titles by key once they are all added.
+func (c *Completer) sortTitles() {
+	sort.Slice(c.titles, func(i, j int) bool {
+		return c.titles[i].key < c.titles[j].key
+	})
+}
+
+// titlePopularity returns the document frequency of the rarest surface form of a title.
+func titlePopularity(forms []string, vocabulary map[string]int) int {
+	popularity := 0
+	for i, form := range forms {
+		if df := vocabulary[form]; i == 0 || df < popularity {
+			popularity = df
+		}
+	}
+	return popularity
+}
+
+// CompleteTerm returns up to n terms starting with prefix, most frequent first.
+func (c *Completer) CompleteTerm(prefix string, n int) []Completion {
+	prefix = strings.ToLower(prefix)
+	if prefix == "" {
+		return nil
+	}
+
+	var completions []Completion
+	for _, term := range c.terms.withPrefix(prefix) {
+		completions = append(completions, Completion{Text: term, Weight: c.freqs[term]})
+	}
+	return topCompletions(completions, n)
+}
+
+// CompleteTitle returns up to n document titles starting with prefix, most popular first.
+// Matching ignores case.
+func (c *Completer) CompleteTitle(prefix string, n int) []Completion {
+	key := strings.ToLower(prefix)
+	if strings.TrimSpace(key) == "" {
+		return nil
+	}
+
+	lo := sort.Search(len(c.titles), func(i int) bool {
+		return c.titles[i].key >= key
+	})
+	var completions []Completion
+	for _, entry := range c.titles[lo:] {
+		if !strings.HasPrefix(entry.key, key) {
+			break
+		}
+		completions = append(completions, Completion{Text: entry.title, Weight: entry.popularity, Title: true})
+	}
+	return topCompletions(completions, n)
+}
+
+// Complete returns up to n completions of query: titles starting with the whole
+// query first, then completions of its last word as a term.
+func (c *Completer) Complete(query string, n int) []Completion {
+	completions := c.CompleteTitle(query, n)
+
+	// Complete the last word, keeping everything before it
+	start := 0
+	if i := strings.LastIndexFunc(query, func(r rune) bool { return !isWordRune(r) }); i >= 0 {
+		_, size := utf8.DecodeRuneInString(query[i:])
+		start = i + size
+	}
+	for _, completion := range c.CompleteTerm(query[start:], n-len(completions)) {
+		completion.Text = query[:start] + completion.Text
+		completions = append(completions, completion)
+	}
+	return completions
+}
+
+// topCompletions sorts completions by weight, highest first, and keeps at most n.
+func topCompletions(completions []Completion, n int) []Completion {
+	sort.SliceStable(completions, func(i, j int) bool {
+		return completions[i].Weight > completions[j].Weight
+	})
+	if len(completions) > max(n, 0) {
+		completions = completions[:max(n, 0)]
+	}
+	return completions
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompleter(t *testing.T) {
+	docs := []*Document{
+		{ID: 0, Title: "Wikipedia: Quantum mechanics", Text: "Quantum mechanics is a fundamental theory in physics."},
+		{ID: 1, Title: "Wikipedia: Quantum field theory", Text: "Quantum field theory combines quantum mechanics and relativity."},
+		{ID: 2, Title: "Wikipedia: Quantity", Text: "Quantity is a property that can exist as a magnitude."},
+		{ID: 3, Title: "Wikipedia: Quark", Text: "A quark is a type of elementary particle described by quantum theory."},
+	}
+	idx := NewIndex()
+	idx.Add(docs)
+	c := NewCompleter(idx.SurfaceForms(), idx.Analyzer(), docs)
+
+	// Terms are ranked by document frequency
+	assert.Equal(t, []Completion{
+		{Text: "quantum", Weight: 3},
+		{Text: "quantity", Weight: 1},
+	}, c.CompleteTerm("Quant", 5))
+	assert.Len(t, c.CompleteTerm("qua", 2), 2)
+	assert.Empty(t, c.CompleteTerm("", 5))
+
+	// Titles are matched ignoring case and the dump's title prefix
+	titles := c.CompleteTitle("quantum ", 5)
+	assert.Len(t, titles, 2)
+	assert.ElementsMatch(t, []string{"Quantum mechanics", "Quantum field theory"}, []string{titles[0].Text, titles[1].Text})
+	assert.True(t, titles[0].Title)
+
+	// The whole query is completed as a title, its last word as a term
+	assert.Equal(t, []Completion{
+		{Text: "Quark", Weight: 1, Title: true},
+		{Text: "quark", Weight: 1},
+	}, c.Complete("quar", 5))
+	assert.Equal(t, []Completion{
+		{Text: "field theory", Weight: 3},
+	}, c.Complete("field the", 5))
+}
+
+func TestIndexCompleter(t *testing.T) {
+	docs := make([]*Document, completerBatch+2)
+	for i := range docs {
+		docs[i] = &Document{ID: i, Title: fmt.Sprintf("Wikipedia: Quark %d", i), Text: "A quark is an elementary particle."}
+	}
+	for name, idx := range map[string]Indexer{
+		"Index":           NewIndex(),
+		"ConcurrentIndex": NewConcurrentIndex(),
+		"ShardedIndex":    NewShardedIndex(3),
+	} {
+		idx.Add(docs)
+		c, err := NewIndexCompleter(idx)
+		assert.NoError(t, err, name)
+		assert.Equal(t, NewCompleter(idx.SurfaceForms(), idx.Analyzer(), docs), c, name)
+	}
+}
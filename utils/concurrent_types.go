@@ -5,6 +5,7 @@ import "sync"
 // ConcurrentIndexEntry stores document IDs and their frequencies with thread-safe access
 type ConcurrentIndexEntry struct {
 	sync.RWMutex
-	DocIDs []int
-	Freqs  []float32
+	DocIDs    []int
+	Freqs     []float32
+	Positions PositionList
 }
@@ -10,13 +10,39 @@ import (
 
 // Document represents a Wikipedia abstract dump Document.
 type Document struct {
-	Title string `xml:"title"`
-	URL   string `xml:"url"`
-	Text  string `xml:"abstract"`
-	ID    int
+	Title string   `xml:"title"`
+	URL   string   `xml:"url"`
+	Text  string   `xml:"abstract"`
+	Lang  Language `xml:"-"` // Language of the text, detected while indexing if empty
+	Key   string   `xml:"-"` // External key, such as the URL; the index assigns the ID of documents with one
+	ID    int      // Internal ID, replaced by the next one if taken by an earlier document
 }
 
-// LoadDocuments parses a Wikipedia abstract dump and returns a slice of documents.
+// Names of the document fields that can be indexed
+const (
+	FieldTitle = "title"
+	FieldText  = "text"
+	FieldURL   = "url"
+	FieldLang  = "lang"
+)
+
+// Field returns the value of the named field, or an empty string for unknown fields.
+func (d *Document) Field(name string) string {
+	switch name {
+	case FieldTitle:
+		return d.Title
+	case FieldText:
+		return d.Text
+	case FieldURL:
+		return d.URL
+	case FieldLang:
+		return string(d.Lang)
+	}
+	return ""
+}
+
+// LoadDocuments parses a Wikipedia abstract dump and returns a slice of documents,
+// keyed by their URL.
 // Dump example: https://dumps.wikimedia.your.org/enwiki/latest/enwiki-latest-abstract1.xml.gz
 func LoadDocuments(path string) ([]*Document, error) {
 	f, err := os.Open(path)
@@ -55,6 +81,7 @@ func LoadDocuments(path string) ([]*Document, error) {
 			defer wg.Done()
 			for i := start; i < end; i++ {
 				docs[i].ID = i
+				docs[i].Key = docs[i].URL
 			}
 		}(start, end)
 	}
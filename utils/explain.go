@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Explanation is a component of the score of a document, with the components it is
+// computed from, see Index.Explain.
+type Explanation struct {
+	Value       float32
+	Description string
+	Details     []Explanation
+}
+
+// String returns the explanation as an indented tree, one component per line.
+func (e Explanation) String() string {
+	var b strings.Builder
+	e.write(&b, 0)
+	return b.String()
+}
+
+func (e Explanation) write(b *strings.Builder, depth int) {
+	fmt.Fprintf(b, "%s%.6g %s\n", strings.Repeat("  ", depth), e.Value, e.Description)
+	for _, detail := range e.Details {
+		detail.write(b, depth+1)
+	}
+}
+
+// explain returns the explanation of the score of docID for the query text,
+// following the computation of search step by step.
+func explain(src termSource, text string, docID int) (Explanation, error) {
+	analyzers, err := queryAnalyzers(context.Background(), src, text)
+	if err != nil {
+		return Explanation{}, err
+	}
+	q, err := expandClauses(context.Background(), src, parseQuery(text), analyzers)
+	if err != nil {
+		return Explanation{}, err
+	}
+
+	for field, terms := range q.filters {
+		if !matchesFilter(src.fieldSource(field), terms, docID) {
+			return Explanation{Description: fmt.Sprintf("no match, rejected by the filter on %s", field)}, nil
+		}
+	}
+
+	e := Explanation{Description: fmt.Sprintf("score of document %d, sum of:", docID)}
+	docCount := src.numDocs()
+	for _, group := range q.groups {
+		var matched Explanation
+		if len(group) == 1 {
+			matched = explainTerm(src, docCount, group[0], docID)
+		} else {
+			// Terms expanded from one clause compete, see scoreGroups
+			matched = Explanation{Description: "max of:"}
+			for _, wt := range group {
+				if term := explainTerm(src, docCount, wt, docID); term.Details != nil {
+					matched.Value = bestScore(matched.Value, term.Value)
+					matched.Details = append(matched.Details, term)
+				}
+			}
+		}
+		if matched.Details != nil {
+			e.Value += matched.Value
+			e.Details = append(e.Details, matched)
+		}
+	}
+	if e.Details == nil {
+		e.Description = fmt.Sprintf("no matching terms in document %d", docID)
+	}
+	return e, nil
+}
+
+// matchesFilter reports whether docID contains any of the terms of a filter field.
+func matchesFilter(src termSource, terms []string, docID int) bool {
+	for _, term := range terms {
+		entry, _ := src.lookup(term)
+		if postingIndex(entry, docID) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// explainTerm explains the score of docID for a weighted term, see scoreTerm.
+// The explanation has no details if the document does not match.
+func explainTerm(src termSource, docCount int, wt weightedTerm, docID int) Explanation {
+	field := wt.field
+	if field == "" {
+		field = FieldText
+	}
+	if wt.phrase == nil {
+		return explainPosting(src.fieldSource(wt.field), docCount, wt.term, wt.weight, field, docID)
+	}
+
+	e := Explanation{Description: fmt.Sprintf("phrase %q in %s, sum of:", strings.Join(wt.phrase, " "), field)}
+	fieldSrc := src.fieldSource(wt.field)
+	entries := make([]IndexEntry, len(wt.phrase))
+	matched := make([]int, len(wt.phrase))
+	for i, term := range wt.phrase {
+		entries[i], _ = fieldSrc.lookup(term)
+		if matched[i] = postingIndex(entries[i], docID); matched[i] < 0 {
+			return Explanation{Description: e.Description}
+		}
+	}
+	if !phraseMatches(entries, matched, wt.offset) {
+		return Explanation{Description: e.Description}
+	}
+	for _, term := range wt.phrase {
+		posting := explainPosting(fieldSrc, docCount, term, wt.weight, field, docID)
+		e.Value += posting.Value
+		e.Details = append(e.Details, posting)
+	}
+	return e
+}
+
+// explainPosting explains the TF-IDF score of term in docID.
+func explainPosting(src termSource, docCount int, term string, weight float32, field string, docID int) Explanation {
+	e := Explanation{Description: fmt.Sprintf("weight of %q in %s, product of:", term, field)}
+	entry, _ := src.lookup(term)
+	i := postingIndex(entry, docID)
+	if i < 0 {
+		return e
+	}
+
+	df := src.docFreq(term)
+	idf := inverseDocFreq(docCount, df)
+	freq := entry.Positions.Count(i)
+	tf := entry.Freqs[i]
+	e.Value = tf * (idf * weight)
+	e.Details = []Explanation{
+		{Value: tf, Description: fmt.Sprintf("tf, %d occurrences / %.0f terms in the document", freq, float32(freq)/tf)},
+		{Value: idf, Description: fmt.Sprintf("idf, log(N / (df + 1)) + 1 with N = %d documents, df = %d", docCount, df)},
+	}
+	if weight != 1 {
+		e.Details = append(e.Details, Explanation{Value: weight, Description: "query weight, lower for inexact matches"})
+	}
+	return e
+}
+
+// postingIndex returns the index of the posting of docID in entry, or -1.
+func postingIndex(entry IndexEntry, docID int) int {
+	for i, id := range entry.DocIDs {
+		if id == docID {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain(t *testing.T) {
+	docs := []*Document{
+		{ID: 0, Title: "Cats", Text: "The cat sat on the mat with another cat"},
+		{ID: 1, Title: "Dogs", Text: "A dog chased the cat"},
+		{ID: 2, Title: "Birds", Text: "Birds sing in the morning"},
+		{ID: 3, Title: "Catalogue", Text: "A catalogue of cats and dogs"},
+	}
+
+	for _, idx := range []Indexer{NewIndex(WithField(FieldTitle, NewEnglishAnalyzer())), NewConcurrentIndex(WithField(FieldTitle, NewEnglishAnalyzer()))} {
+		idx.Add(docs)
+
+		// Explanations add up to the scores of search results
+		for _, query := range []string{"cat", "cat dog", "cats~1", "cat*", `"the cat"`, `"dog chased"`, "title:cats dog", "sing [a TO c]"} {
+			results := idx.Search(query)
+			assert.NotEmpty(t, results, query)
+			for _, result := range results {
+				e, err := idx.Explain(query, result.DocID)
+				assert.NoError(t, err)
+				assert.Equal(t, result.Score, e.Value, "%s: %v", query, e)
+			}
+		}
+
+		e, err := idx.Explain("cat", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, "score of document 0, sum of:", e.Description)
+		assert.Len(t, e.Details, 1)
+		term := e.Details[0]
+		assert.Equal(t, `weight of "cat" in text, product of:`, term.Description)
+		assert.Equal(t, "tf, 2 occurrences / 5 terms in the document", term.Details[0].Description)
+		assert.Equal(t, "idf, log(N / (df + 1)) + 1 with N = 4 documents, df = 3", term.Details[1].Description)
+		assert.Equal(t, term.Details[0].Value*term.Details[1].Value, term.Value)
+
+		// Inexact matches show their weight
+		e, err = idx.Explain("cst~1", 0)
+		assert.NoError(t, err)
+		assert.Contains(t, e.String(), "query weight")
+
+		e, err = idx.Explain("cat", 2)
+		assert.NoError(t, err)
+		assert.Zero(t, e.Value)
+		assert.Empty(t, e.Details)
+
+		_, err = idx.Explain("cat", 42)
+		assert.ErrorIs(t, err, ErrDocumentNotFound)
+	}
+}
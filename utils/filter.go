@@ -3,84 +3,167 @@ package utils
 import (
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	snowballeng "github.com/kljensen/snowball/english"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
 )
 
 // lowercaseFilter returns a slice of tokens normalized to lower case.
-func lowercaseFilter(tokens []string) []string {
-	r := make([]string, len(tokens))
-	for i, token := range tokens {
-		r[i] = strings.ToLower(token)
+func lowercaseFilter(tokens []Token) []Token {
+	return mapTerms(tokens, strings.ToLower)
+}
+
+// nfkcFilter returns a slice of tokens in Unicode normalization form NFKC, so that
+// compatibility characters such as ligatures ("ﬁ") or full-width digits ("１")
+// become their usual equivalents.
+func nfkcFilter(tokens []Token) []Token {
+	return mapTerms(tokens, norm.NFKC.String)
+}
+
+// caseFoldFilter returns a slice of tokens with Unicode full case folding applied.
+// Unlike lowercaseFilter it maps every case variant of a letter to the same form,
+// e.g. "ß" and "ẞ" to "ss", and "ς" to "σ".
+func caseFoldFilter(tokens []Token) []Token {
+	return mapTerms(tokens, cases.Fold().String)
+}
+
+// turkicCaseFoldFilter returns a slice of tokens with Unicode full case folding
+// applied, using the Turkic mappings of the dotted and dotless I: "I" becomes "ı"
+// and "İ" becomes "i", rather than "i" and "i̇".
+func turkicCaseFoldFilter(tokens []Token) []Token {
+	return mapTerms(tokens, turkicFold)
+}
+
+// turkicFold applies full case folding to s with the Turkic mappings of I.
+func turkicFold(s string) string {
+	return cases.Fold().String(strings.Map(func(r rune) rune {
+		switch r {
+		case 'I':
+			return 'ı'
+		case 'İ':
+			return 'i'
+		}
+		return r
+	}, s))
+}
+
+// asciiFoldings are letters that do not decompose into a base letter and
+// combining marks, with their usual ASCII spelling.
+var asciiFoldings = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'ø': "o", 'Ø': "O",
+	'đ': "d", 'Đ': "D", 'ð': "d", 'Ð': "D", 'ł': "l", 'Ł': "L", 'þ': "th", 'Þ': "TH",
+	'ı': "i", 'ħ': "h", 'Ħ': "H", 'ŋ': "n", 'Ŋ': "N",
+}
+
+// asciiFoldingFilter returns a slice of tokens with diacritics removed from Latin
+// letters, so that "Zürich" and "Zurich" or "café" and "cafe" become the same term.
+// Letters of other scripts are left alone.
+func asciiFoldingFilter(tokens []Token) []Token {
+	return mapTerms(tokens, asciiFold)
+}
+
+// asciiFold removes diacritics from the Latin letters of s.
+func asciiFold(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	folded, latin := false, false
+	for _, c := range norm.NFD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, c):
+			// Drop combining marks following a Latin letter
+			if latin {
+				folded = true
+				continue
+			}
+			b.WriteRune(c)
+		case asciiFoldings[c] != "":
+			b.WriteString(asciiFoldings[c])
+			folded, latin = true, true
+		default:
+			b.WriteRune(c)
+			latin = unicode.Is(unicode.Latin, c)
+		}
 	}
-	return r
+	if !folded {
+		return s
+	}
+	return norm.NFC.String(b.String())
 }
 
-// characterFilter removes unwanted characters from tokens
-func characterFilter(tokens []string) []string {
-	r := make([]string, 0, len(tokens))
+// characterFilter removes unwanted characters from words, moving their offsets
+// past the characters removed. Other tokens, such as URLs, are kept as they are.
+func characterFilter(tokens []Token) []Token {
+	r := make([]Token, 0, len(tokens))
 	for _, token := range tokens {
 		// Remove non-alphanumeric characters from start and end
-		token = strings.TrimFunc(token, func(r rune) bool {
-			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
-		})
+		if token.Type == WordToken {
+			isTrimmed := func(r rune) bool { return !isWordRune(r) }
+			trimmed := strings.TrimLeftFunc(token.Term, isTrimmed)
+			token.Start += len(token.Term) - len(trimmed)
+			token.Term = strings.TrimRightFunc(trimmed, isTrimmed)
+			token.End -= len(trimmed) - len(token.Term)
+		}
 
-		// Skip empty tokens or those that are too short
-		if len(token) < 2 {
+		// Skip empty tokens or those that are too short, except ideographs
+		if utf8.RuneCountInString(token.Term) < 2 && !isSingleCharacterWord(token.Term) {
 			continue
 		}
 
 		r = append(r, token)
 	}
+	setIncrements(r)
 	return r
 }
 
-// stopwordFilter returns a slice of tokens with stop words removed.
-func stopwordFilter(tokens []string) []string {
-	var stopwords = map[string]struct{}{
-		"a": {}, "about": {}, "above": {}, "after": {}, "again": {}, "against": {}, "all": {},
-		"am": {}, "an": {}, "and": {}, "any": {}, "are": {}, "aren't": {}, "as": {}, "at": {},
-		"be": {}, "because": {}, "been": {}, "before": {}, "being": {}, "below": {}, "between": {},
-		"both": {}, "but": {}, "by": {}, "can": {}, "can't": {}, "cannot": {}, "could": {},
-		"couldn't": {}, "did": {}, "didn't": {}, "do": {}, "does": {}, "doesn't": {}, "doing": {},
-		"don't": {}, "down": {}, "during": {}, "each": {}, "few": {}, "for": {}, "from": {},
-		"further": {}, "had": {}, "hadn't": {}, "has": {}, "hasn't": {}, "have": {}, "haven't": {},
-		"having": {}, "he": {}, "he'd": {}, "he'll": {}, "he's": {}, "her": {}, "here": {},
-		"here's": {}, "hers": {}, "herself": {}, "him": {}, "himself": {}, "his": {}, "how": {},
-		"how's": {}, "i": {}, "i'd": {}, "i'll": {}, "i'm": {}, "i've": {}, "if": {}, "in": {},
-		"into": {}, "is": {}, "isn't": {}, "it": {}, "it's": {}, "its": {}, "itself": {},
-		"let's": {}, "me": {}, "more": {}, "most": {}, "mustn't": {}, "my": {}, "myself": {},
-		"no": {}, "nor": {}, "not": {}, "of": {}, "off": {}, "on": {}, "once": {}, "only": {},
-		"or": {}, "other": {}, "ought": {}, "our": {}, "ours": {}, "ourselves": {}, "out": {},
-		"over": {}, "own": {}, "same": {}, "shan't": {}, "she": {}, "she'd": {}, "she'll": {},
-		"she's": {}, "should": {}, "shouldn't": {}, "so": {}, "some": {}, "such": {}, "than": {},
-		"that": {}, "that's": {}, "the": {}, "their": {}, "theirs": {}, "them": {}, "themselves": {},
-		"then": {}, "there": {}, "there's": {}, "these": {}, "they": {}, "they'd": {}, "they'll": {},
-		"they're": {}, "they've": {}, "this": {}, "those": {}, "through": {}, "to": {}, "too": {},
-		"under": {}, "until": {}, "up": {}, "very": {}, "was": {}, "wasn't": {}, "we": {},
-		"we'd": {}, "we'll": {}, "we're": {}, "we've": {}, "were": {}, "weren't": {}, "what": {},
-		"what's": {}, "when": {}, "when's": {}, "where": {}, "where's": {}, "which": {},
-		"while": {}, "who": {}, "who's": {}, "whom": {}, "why": {}, "why's": {}, "with": {},
-		"won't": {}, "would": {}, "wouldn't": {}, "you": {}, "you'd": {}, "you'll": {},
-		"you're": {}, "you've": {}, "your": {}, "yours": {}, "yourself": {}, "yourselves": {},
-	}
+// englishStopwords are common English words carrying little meaning on their own.
+var englishStopwords = map[string]struct{}{
+	"a": {}, "about": {}, "above": {}, "after": {}, "again": {}, "against": {}, "all": {},
+	"am": {}, "an": {}, "and": {}, "any": {}, "are": {}, "aren't": {}, "as": {}, "at": {},
+	"be": {}, "because": {}, "been": {}, "before": {}, "being": {}, "below": {}, "between": {},
+	"both": {}, "but": {}, "by": {}, "can": {}, "can't": {}, "cannot": {}, "could": {},
+	"couldn't": {}, "did": {}, "didn't": {}, "do": {}, "does": {}, "doesn't": {}, "doing": {},
+	"don't": {}, "down": {}, "during": {}, "each": {}, "few": {}, "for": {}, "from": {},
+	"further": {}, "had": {}, "hadn't": {}, "has": {}, "hasn't": {}, "have": {}, "haven't": {},
+	"having": {}, "he": {}, "he'd": {}, "he'll": {}, "he's": {}, "her": {}, "here": {},
+	"here's": {}, "hers": {}, "herself": {}, "him": {}, "himself": {}, "his": {}, "how": {},
+	"how's": {}, "i": {}, "i'd": {}, "i'll": {}, "i'm": {}, "i've": {}, "if": {}, "in": {},
+	"into": {}, "is": {}, "isn't": {}, "it": {}, "it's": {}, "its": {}, "itself": {},
+	"let's": {}, "me": {}, "more": {}, "most": {}, "mustn't": {}, "my": {}, "myself": {},
+	"no": {}, "nor": {}, "not": {}, "of": {}, "off": {}, "on": {}, "once": {}, "only": {},
+	"or": {}, "other": {}, "ought": {}, "our": {}, "ours": {}, "ourselves": {}, "out": {},
+	"over": {}, "own": {}, "same": {}, "shan't": {}, "she": {}, "she'd": {}, "she'll": {},
+	"she's": {}, "should": {}, "shouldn't": {}, "so": {}, "some": {}, "such": {}, "than": {},
+	"that": {}, "that's": {}, "the": {}, "their": {}, "theirs": {}, "them": {}, "themselves": {},
+	"then": {}, "there": {}, "there's": {}, "these": {}, "they": {}, "they'd": {}, "they'll": {},
+	"they're": {}, "they've": {}, "this": {}, "those": {}, "through": {}, "to": {}, "too": {},
+	"under": {}, "until": {}, "up": {}, "very": {}, "was": {}, "wasn't": {}, "we": {},
+	"we'd": {}, "we'll": {}, "we're": {}, "we've": {}, "were": {}, "weren't": {}, "what": {},
+	"what's": {}, "when": {}, "when's": {}, "where": {}, "where's": {}, "which": {},
+	"while": {}, "who": {}, "who's": {}, "whom": {}, "why": {}, "why's": {}, "with": {},
+	"won't": {}, "would": {}, "wouldn't": {}, "you": {}, "you'd": {}, "you'll": {},
+	"you're": {}, "you've": {}, "your": {}, "yours": {}, "yourself": {}, "yourselves": {},
+}
 
-	r := make([]string, 0, len(tokens))
-	for _, token := range tokens {
-		if _, ok := stopwords[token]; !ok {
-			r = append(r, token)
-		}
-	}
-	return r
+// isEnglishStopword reports whether token is an English stop word.
+func isEnglishStopword(token string) bool {
+	_, ok := englishStopwords[token]
+	return ok
+}
+
+// stopwordFilter returns a slice of tokens with stop words removed.
+func stopwordFilter(tokens []Token) []Token {
+	return keepTokens(tokens, func(token Token) bool {
+		return !isEnglishStopword(token.Term)
+	})
 }
 
 // stemmerFilter returns a slice of stemmed tokens.
 // Stemming is the process of reducing a word to its base or root form, which helps normalize words for text analysis.
 // For example, "running," "runner," and "runs" might all be reduced to the root form "run".
-func stemmerFilter(tokens []string) []string {
-	r := make([]string, len(tokens))
-	for i, token := range tokens {
-		r[i] = snowballeng.Stem(token, false)
-	}
-	return r
+func stemmerFilter(tokens []Token) []Token {
+	return mapTerms(tokens, func(term string) string {
+		return snowballeng.Stem(term, false)
+	})
 }
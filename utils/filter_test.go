@@ -11,7 +11,7 @@ func TestLowercaseFilter(t *testing.T) {
 		in  = []string{"Cat", "DOG", "fish"}
 		out = []string{"cat", "dog", "fish"}
 	)
-	assert.Equal(t, out, lowercaseFilter(in))
+	assert.Equal(t, out, tokenTerms(lowercaseFilter(newTokens(in))))
 }
 
 func TestStopwordFilter(t *testing.T) {
@@ -19,7 +19,10 @@ func TestStopwordFilter(t *testing.T) {
 		in  = []string{"i", "am", "the", "cat"}
 		out = []string{"cat"}
 	)
-	assert.Equal(t, out, stopwordFilter(in))
+	assert.Equal(t, out, tokenTerms(stopwordFilter(newTokens(in))))
+
+	// Kept tokens keep their position
+	assert.Equal(t, []Token{{Term: "cat", Position: 3, PositionIncrement: 4}}, stopwordFilter(newTokens(in)))
 }
 
 func TestStemmerFilter(t *testing.T) {
@@ -27,7 +30,7 @@ func TestStemmerFilter(t *testing.T) {
 		in  = []string{"cat", "cats", "fish", "fishing", "fished", "airline"}
 		out = []string{"cat", "cat", "fish", "fish", "fish", "airlin"}
 	)
-	assert.Equal(t, out, stemmerFilter(in))
+	assert.Equal(t, out, tokenTerms(stemmerFilter(newTokens(in))))
 }
 
 func TestCharacterFilter(t *testing.T) {
@@ -61,6 +64,11 @@ func TestCharacterFilter(t *testing.T) {
 			input:    []string{"", "!", "@", "a", "#b#"},
 			expected: []string{},
 		},
+		{
+			name:     "Count characters rather than bytes",
+			input:    []string{"é", "éa", "猫", "猫!"},
+			expected: []string{"éa", "猫", "猫"},
+		},
 		{
 			name:     "Numbers and mixed content",
 			input:    []string{"2023", "version2.0", "!2024!"},
@@ -68,10 +76,52 @@ func TestCharacterFilter(t *testing.T) {
 		},
 	}
 
+	// Offsets move past the characters trimmed
+	assert.Equal(t, []Token{
+		{Term: "hello", Start: 2, End: 7, Position: 0, PositionIncrement: 1},
+		{Term: "猫", Start: 10, End: 13, Position: 2, PositionIncrement: 2},
+	}, characterFilter([]Token{
+		{Term: "¡hello!", Start: 0, End: 8, Position: 0, PositionIncrement: 1},
+		{Term: "a", Start: 9, End: 10, Position: 1, PositionIncrement: 1},
+		{Term: "猫!", Start: 10, End: 14, Position: 2, PositionIncrement: 1},
+	}))
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := characterFilter(tt.input)
+			result := tokenTerms(characterFilter(newTokens(tt.input)))
 			assert.Equal(t, tt.expected, result, "Test case: %s", tt.name)
 		})
 	}
 }
+
+func TestNFKCFilter(t *testing.T) {
+	var (
+		in  = []string{"ﬁle", "１２３", "Ⅳ", "plain"}
+		out = []string{"file", "123", "IV", "plain"}
+	)
+	assert.Equal(t, out, tokenTerms(nfkcFilter(newTokens(in))))
+}
+
+func TestCaseFoldFilter(t *testing.T) {
+	var (
+		in  = []string{"Straße", "STRASSE", "ΣΊΣΥΦΟΣ", "σίσυφος", "ǅ"}
+		out = []string{"strasse", "strasse", "σίσυφοσ", "σίσυφοσ", "ǆ"}
+	)
+	assert.Equal(t, out, tokenTerms(caseFoldFilter(newTokens(in))))
+}
+
+func TestTurkicCaseFoldFilter(t *testing.T) {
+	var (
+		in  = []string{"ISTANBUL", "İstanbul", "DİYARBAKIR", "Straße"}
+		out = []string{"ıstanbul", "istanbul", "diyarbakır", "strasse"}
+	)
+	assert.Equal(t, out, tokenTerms(turkicCaseFoldFilter(newTokens(in))))
+}
+
+func TestASCIIFoldingFilter(t *testing.T) {
+	var (
+		in  = []string{"zürich", "café", "ﬁancée", "straße", "øresund", "łódź", "istanbul", "i̇stanbul", "йогурт", "plain"}
+		out = []string{"zurich", "cafe", "ﬁancee", "strasse", "oresund", "lodz", "istanbul", "istanbul", "йогурт", "plain"}
+	)
+	assert.Equal(t, out, tokenTerms(asciiFoldingFilter(newTokens(in))))
+}
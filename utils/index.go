@@ -1,81 +1,395 @@
 package utils
 
 import (
-	"math"
+	"context"
+	"errors"
 	"sort"
 )
 
 // IndexEntry stores document IDs and their frequencies
 type IndexEntry struct {
-	DocIDs []int
-	Freqs  []float32
+	DocIDs    []int // In increasing order, as documents are given increasing IDs
+	Freqs     []float32
+	Positions PositionList // Positions of the term in each document
 }
 
 // Index is an inverted index. It maps tokens to document IDs and their frequencies.
 type Index struct {
+	field    string            // document field indexed
+	fields   map[string]*Index // indexes of additional fields
 	entries  map[string]*IndexEntry
+	surfaces map[string]int // unstemmed term -> document frequency
+	dict     *termDict      // sorted surface forms, rebuilt lazily after new ones are added
+	store    *docStore      // stored fields of the documents, nil for the indexes of fields
 	docCount int
+	tokens   int64       // number of index terms of the documents, for the average document length
+	stats    *IndexStats // statistics from the postings, computed by Stats until documents are added
+	config   indexConfig
+
+	// Internal IDs of the documents with a key, see Document.Key
+	keys     map[string]int
+	replaced map[int]struct{} // IDs of documents replaced by a later one with the same key
+	nextID   int
+	removed  map[string]int // term -> number of replaced documents containing it, see removedStats
+
+	// Estimated memory held by entries, see WithMemoryBudget
+	memBytes     int64
+	peakMemBytes int64
+	spill        *spillStore // postings spilled to disk, nil without a memory budget
 }
 
 // NewIndex creates a new Index instance
-func NewIndex() *Index {
-	return &Index{
-		entries: make(map[string]*IndexEntry),
+func NewIndex(opts ...IndexOption) *Index {
+	idx := newFieldIndex(FieldText, newIndexConfig(opts))
+	idx.store = newDocStore()
+	idx.keys = make(map[string]int)
+	return idx
+}
+
+// newFieldIndex creates an Index of a single document field, along with the
+// indexes of the additional fields configured in cfg.
+func newFieldIndex(field string, cfg indexConfig) *Index {
+	idx := &Index{
+		field:    field,
+		fields:   make(map[string]*Index),
+		config:   cfg,
+		entries:  make(map[string]*IndexEntry),
+		surfaces: make(map[string]int),
+	}
+	if cfg.memoryBudget > 0 {
+		idx.spill = newSpillStore(cfg.memoryBudget, cfg.spillDir)
 	}
+	for _, f := range cfg.fields {
+		idx.fields[f.name] = newFieldIndex(f.name, cfg.fieldConfig(f))
+	}
+	return idx
 }
 
 func (idx *Index) Clear() {
 	idx.entries = make(map[string]*IndexEntry)
+	idx.surfaces = make(map[string]int)
+	idx.dict = nil
+	if idx.store != nil {
+		idx.store = newDocStore()
+		idx.keys = make(map[string]int)
+	}
+	idx.replaced = nil
+	idx.nextID = 0
+	idx.removed = nil
+	idx.stats = nil
 	idx.docCount = 0
+	idx.tokens = 0
+	idx.memBytes, idx.peakMemBytes = 0, 0
+	if idx.spill != nil {
+		idx.spill.close()
+	}
+	for _, fieldIdx := range idx.fields {
+		fieldIdx.Clear()
+	}
+}
+
+// Close removes the files holding the postings of an Index with a memory budget,
+// along with its documents. The Index is empty afterwards.
+func (idx *Index) Close() error {
+	var errs []error
+	if idx.spill != nil {
+		errs = append(errs, idx.spill.close())
+	}
+	for _, fieldIdx := range idx.fields {
+		errs = append(errs, fieldIdx.Close())
+	}
+	idx.Clear()
+	return errors.Join(errs...)
+}
+
+// DocumentCount returns the number of documents indexed, replaced ones excluded.
+func (idx *Index) DocumentCount() int {
+	return idx.docCount
 }
 
 func (idx *Index) Stats() IndexStats {
-	return IndexStats{
-		DocumentCount: idx.docCount,
-		TermCount:     len(idx.entries),
+	if idx.stats == nil {
+		stats := indexStats(idx, idx.vocabulary(), idx.tokens)
+		idx.stats = &stats
 	}
+	stats := *idx.stats
+	stats.PeakMemoryBytes = idx.peakMemBytes
+	if idx.spill != nil {
+		stats.Spills = idx.spill.spills
+	}
+	return stats
 }
 
-// Add adds documents to the Index with TF-IDF scoring
-func (idx *Index) Add(docs []*Document) {
-	if len(docs) == 0 {
-		return
+// TermStats returns the statistics of an index term, as produced by the analyzer.
+func (idx *Index) TermStats(term string) (TermStats, bool) {
+	return termStats(idx, term)
+}
+
+// TopTerms returns the statistics of the n index terms occurring most often.
+func (idx *Index) TopTerms(n int) []TermStats {
+	return topTerms(idx, idx.vocabulary(), n)
+}
+
+// vocabulary returns the distinct index terms, whether in memory or on disk.
+func (idx *Index) vocabulary() []string {
+	terms := make([]string, 0, len(idx.entries))
+	for term := range idx.entries {
+		terms = append(terms, term)
+	}
+	if idx.spill != nil {
+		for term := range idx.spill.terms {
+			if _, ok := idx.entries[term]; !ok {
+				terms = append(terms, term)
+			}
+		}
 	}
+	return terms
+}
+
+// Add adds documents to the Index with TF-IDF scoring. Use AddContext to get the
+// errors of an Index with a memory budget writing its postings to disk.
+func (idx *Index) Add(docs []*Document) {
+	idx.AddContext(context.Background(), docs)
+}
 
-	// Update document count for IDF calculation
-	idx.docCount += len(docs)
+// AddContext is like Add but stops adding documents once ctx is done, returning
+// ctx.Err(). The documents added until then, a prefix of docs, stay indexed.
+// It also stops on the first error spilling postings to disk or storing documents.
+func (idx *Index) AddContext(ctx context.Context, docs []*Document) error {
+	idx.stats = nil
+	// Only the index of the text, which stores documents, assigns their IDs
+	if idx.store != nil {
+		assignIDs(docs, &idx.nextID)
+	}
 
+	var err error
+	added := 0
 	for _, doc := range docs {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		surface, tokens, totalTokens := analyzeDocument(&idx.config, idx.documentAnalyzer(doc), doc.Field(idx.config.documentField(idx.field)))
 
-		// Count token frequencies in document
-		tokenFreq := make(map[string]int)
-		tokens := analyze(doc.Text)
-		totalTokens := len(tokens)
-		if totalTokens == 0 {
+		// Documents are stored once their language is detected
+		if idx.store != nil {
+			if err = idx.store.add(doc); err != nil {
+				break
+			}
+		}
+
+		// Update document count for IDF calculation
+		idx.docCount++
+		added++
+
+		if len(tokens) == 0 {
 			continue
 		}
+		idx.tokens += int64(totalTokens)
 
-		// Calculate term frequencies
-		for _, token := range tokens {
-			tokenFreq[token]++
+		// Record unstemmed forms for spelling suggestions
+		for _, form := range uniqueTokens(surface) {
+			if idx.surfaces[form] == 0 {
+				idx.dict = nil
+			}
+			idx.surfaces[form]++
 		}
 
 		// Update index with document frequencies
-		for token, freq := range tokenFreq {
+		for token, termPos := range termPositions(tokens) {
 			if idx.entries[token] == nil {
 				idx.entries[token] = &IndexEntry{
 					DocIDs: make([]int, 0, 64),
 					Freqs:  make([]float32, 0, 64),
 				}
+				idx.memBytes += entryBytes + int64(len(token))
 			}
 			entry := idx.entries[token]
 
 			entry.DocIDs = append(entry.DocIDs, doc.ID)
 			// Calculate TF as frequency / total tokens in document
-			tf := float32(float64(freq) / float64(totalTokens))
+			tf := float32(float64(len(termPos)) / float64(totalTokens))
 			entry.Freqs = append(entry.Freqs, tf)
+			size := entry.Positions.add(termPos)
+			idx.memBytes += postingBytes + int64(size)
+		}
+		idx.peakMemBytes = max(idx.peakMemBytes, idx.memBytes)
+
+		// Spill postings beyond the memory budget to a sorted run
+		if idx.spill != nil && idx.memBytes > idx.spill.budget {
+			if err = idx.spillEntries(); err != nil {
+				break
+			}
+		}
+	}
+
+	// Merge the spilled runs with the postings left in memory into the postings file
+	if idx.spill != nil && len(idx.spill.runs) > 0 {
+		if spillErr := idx.spillEntries(); spillErr == nil {
+			err = errors.Join(err, idx.spill.merge())
+		} else {
+			err = errors.Join(err, spillErr)
+		}
+	}
+
+	// Field indexes get every added document, even once ctx is done
+	for _, fieldIdx := range idx.fields {
+		err = errors.Join(err, fieldIdx.AddContext(context.WithoutCancel(ctx), docs[:added]))
+	}
+
+	// Documents are replaced once indexed in every field, which they may be replaced in
+	if idx.store != nil {
+		err = errors.Join(err, idx.addKeys(docs[:added]))
+	}
+	return err
+}
+
+// addKeys maps the keys of the added documents docs to their IDs, replacing the
+// documents indexed before with the same keys.
+func (idx *Index) addKeys(docs []*Document) error {
+	all := func(int) bool { return true }
+	replaced := replacedDocs(docs, all, idx.ID)
+	idx.replaced = withReplaced(idx.replaced, replaced)
+	for _, doc := range docs {
+		if doc.Key != "" {
+			idx.keys[doc.Key] = doc.ID
+		}
+	}
+
+	old, err := documents(replaced, nil, idx.store)
+	if err != nil {
+		return err
+	}
+	idx.removeDocs(old)
+	return nil
+}
+
+// removeDocs leaves the replaced documents docs out of the statistics of idx and
+// its fields, see removedStats.
+func (idx *Index) removeDocs(docs []*Document) {
+	var r removedStats
+	for _, doc := range docs {
+		r.add(&idx.config, idx.documentAnalyzer(doc), doc.Field(idx.config.documentField(idx.field)))
+	}
+	idx.docCount -= r.docs
+	idx.tokens -= r.tokens
+	for form, df := range r.surfaces {
+		if idx.surfaces[form] -= df; idx.surfaces[form] <= 0 {
+			delete(idx.surfaces, form)
+			idx.dict = nil
+		}
+	}
+	for term, df := range r.df {
+		if idx.removed == nil {
+			idx.removed = make(map[string]int)
+		}
+		idx.removed[term] += df
+	}
+
+	for _, fieldIdx := range idx.fields {
+		fieldIdx.removeDocs(docs)
+	}
+}
+
+// ID returns the internal ID of the document indexed with key, if any.
+func (idx *Index) ID(key string) (int, bool) {
+	id, ok := idx.keys[key]
+	return id, ok
+}
+
+// Key returns the key of the document docID, if it is indexed with one.
+func (idx *Index) Key(docID int) (string, bool) {
+	doc, err := idx.Get(docID)
+	if err != nil || doc.Key == "" {
+		return "", false
+	}
+	return doc.Key, true
+}
+
+func (idx *Index) live(docID int) bool {
+	_, ok := idx.replaced[docID]
+	return !ok
+}
+
+// spillEntries writes the postings held in memory to a run and forgets them.
+func (idx *Index) spillEntries() error {
+	if len(idx.entries) == 0 {
+		return nil
+	}
+	if err := idx.spill.spill(idx.entries); err != nil {
+		return err
+	}
+	idx.entries = make(map[string]*IndexEntry)
+	idx.memBytes = 0
+	return nil
+}
+
+// analyzeDocument returns the surface forms and index terms of the text of a document
+// field analyzed with a, adding synonyms if cfg applies them at index time and common grams.
+// The length of the document, used for term frequencies, is its number of index terms
+// without synonyms and common grams, so that adding them does not change scores.
+func analyzeDocument(cfg *indexConfig, a Analyzer, text string) (surface []string, tokens []Token, length int) {
+	surfaceTokens := analyzeSurface(a, text)
+	tokens = normalize(a, surfaceTokens)
+	length = len(tokens)
+	var grams []Token
+	if cfg.commonGrams != nil {
+		grams = commonGrams(cfg.commonGrams, surfaceTokens, tokens)
+	}
+
+	if cfg.synonyms != nil && cfg.synonymMode == SynonymsAtIndex {
+		surfaceTokens = cfg.synonyms.addSynonyms(surfaceTokens)
+		tokens = normalize(a, surfaceTokens)
+	}
+	surface = tokenTerms(surfaceTokens)
+	tokens = append(tokens, grams...)
+	return surface, tokens, length
+}
+
+// termPositions maps the term of each distinct token to its positions, in increasing order.
+func termPositions(tokens []Token) map[string][]int {
+	r := make(map[string][]int)
+	for _, token := range tokens {
+		r[token.Term] = append(r[token.Term], token.Position)
+	}
+	for _, p := range r {
+		sort.Ints(p)
+	}
+	return r
+}
+
+// documentAnalyzer returns the analyzer for doc, detecting its language first if needed.
+func (idx *Index) documentAnalyzer(doc *Document) Analyzer {
+	if idx.config.detector == nil {
+		return idx.config.analyzer
+	}
+	if doc.Lang == "" {
+		doc.Lang = idx.config.detector.Detect(doc.Text)
+	}
+	return idx.config.analyzerFor(doc.Lang)
+}
+
+// SurfaceForms returns the unstemmed terms seen while indexing, mapped to the
+// number of documents containing them.
+func (idx *Index) SurfaceForms() map[string]int {
+	forms := make(map[string]int, len(idx.surfaces))
+	for form, df := range idx.surfaces {
+		forms[form] = df
+	}
+	return forms
+}
+
+// uniqueTokens returns the distinct tokens in order of first occurrence.
+func uniqueTokens(tokens []string) []string {
+	seen := make(map[string]struct{}, len(tokens))
+	r := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if _, ok := seen[token]; !ok {
+			seen[token] = struct{}{}
+			r = append(r, token)
 		}
 	}
+	return r
 }
 
 // SearchResult represents a scored search result
@@ -84,43 +398,155 @@ type SearchResult struct {
 	Score float32
 }
 
-// Search queries the Index for the given text and returns scored results
+// Search queries the Index for the given text and returns scored results.
+// Queries that cannot be evaluated return no results, use Query to get the error.
 func (idx *Index) Search(text string) []SearchResult {
-	tokens := analyze(text)
-	if len(tokens) == 0 {
-		return nil
+	results, _ := idx.Query(text)
+	return results
+}
+
+// Query is like Search but reports queries that cannot be evaluated,
+// such as a prefix matching more terms than the maximum expansion count.
+func (idx *Index) Query(text string) ([]SearchResult, error) {
+	return search(context.Background(), idx, text, 0)
+}
+
+// SearchContext is like Query but stops scoring once ctx is done. The documents
+// scored until then are returned as a timed out response if opts allows partial
+// results, otherwise ctx.Err() is returned.
+func (idx *Index) SearchContext(ctx context.Context, text string, opts SearchOptions) (SearchResponse, error) {
+	return searchContext(ctx, idx, text, opts)
+}
+
+// Explain returns how the score of docID for the query text is computed. Its value
+// is the score of the document in the results of Search, or zero if it does not match.
+func (idx *Index) Explain(text string, docID int) (Explanation, error) {
+	if !idx.store.has(docID) || !idx.live(docID) {
+		return Explanation{}, ErrDocumentNotFound
 	}
+	return explain(idx, text, docID)
+}
 
-	// Calculate scores for each matching document
-	scores := make(map[int]float32)
-	for _, token := range tokens {
-		if entry, ok := idx.entries[token]; ok {
-			// Calculate IDF for the current term
-			// IDF = log(N/(df + 1)) + 1
-			idf := float32(math.Log(float64(idx.docCount)/(float64(len(entry.DocIDs))+1.0)) + 1.0)
-			for i, docID := range entry.DocIDs {
-				// Score is TF (from entry.Freqs) * IDF (calculated now)
-				scores[docID] += entry.Freqs[i] * idf
-			}
-		}
+// Analyzer returns the analyzer used for indexed documents and queries.
+func (idx *Index) Analyzer() Analyzer {
+	return idx.config.analyzer
+}
+
+// FieldAnalyzer returns the analyzer used for queries on field, if it is indexed.
+func (idx *Index) FieldAnalyzer(field string) (Analyzer, bool) {
+	return idx.config.fieldAnalyzer(field)
+}
+
+// LanguageAnalyzer returns the analyzer used for documents and queries in lang,
+// if the index detects languages.
+func (idx *Index) LanguageAnalyzer(lang Language) (Analyzer, bool) {
+	return idx.config.languageAnalyzer(lang)
+}
+
+func (idx *Index) fieldSource(name string) termSource {
+	if name == "" || name == idx.field {
+		return idx
 	}
+	if fieldIdx, ok := idx.fields[name]; ok {
+		return fieldIdx
+	}
+	return nil
+}
 
-	if len(scores) == 0 {
-		return nil
+func (idx *Index) settings() *indexConfig {
+	return &idx.config
+}
+
+func (idx *Index) maxExpansions() int {
+	return idx.config.maxExpansions
+}
+
+func (idx *Index) searchWorkers() int {
+	return 1
+}
+
+// MoreLikeThis returns the documents most similar to the indexed document docID,
+// excluding the document itself.
+func (idx *Index) MoreLikeThis(docID int, opts MoreLikeThisOptions) ([]SearchResult, error) {
+	doc, err := idx.Get(docID)
+	if err != nil {
+		return nil, err
 	}
+	return moreLikeThis(idx, doc.Text, docID, opts), nil
+}
 
-	results := make([]SearchResult, 0, len(scores))
-	for docID, score := range scores {
-		results = append(results, SearchResult{
-			DocID: docID,
-			Score: score,
-		})
+// Get returns the stored document docID, or ErrDocumentNotFound if it is not indexed.
+func (idx *Index) Get(docID int) (*Document, error) {
+	docs, err := idx.GetMany([]int{docID})
+	if err != nil {
+		return nil, err
 	}
+	return docs[0], nil
+}
 
-	// Sort results by score (highest first)
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Score > results[j].Score
-	})
+// GetMany returns the stored documents ids, in order, or ErrDocumentNotFound
+// if one of them is not indexed.
+func (idx *Index) GetMany(ids []int) ([]*Document, error) {
+	return documents(ids, idx.replaced, idx.store)
+}
 
-	return results
+// IDs returns the IDs of the indexed documents, in increasing order.
+func (idx *Index) IDs() []int {
+	return storedIDs(idx.replaced, idx.store)
+}
+
+// MoreLikeThisText returns the documents most similar to text.
+func (idx *Index) MoreLikeThisText(text string, opts MoreLikeThisOptions) []SearchResult {
+	return moreLikeThis(idx, text, -1, opts)
+}
+
+func (idx *Index) numDocs() int {
+	return idx.docCount
+}
+
+func (idx *Index) lookup(term string) (IndexEntry, bool) {
+	entry, ok := idx.entries[term]
+	if idx.spill == nil {
+		if !ok {
+			return IndexEntry{}, false
+		}
+		return *entry, true
+	}
+
+	// Postings on disk were added first
+	disk, onDisk := idx.spill.lookup(term)
+	switch {
+	case onDisk && ok:
+		return appendEntry(disk, *entry), true
+	case ok:
+		return *entry, true
+	default:
+		return disk, onDisk
+	}
+}
+
+func (idx *Index) docFreq(term string) int {
+	df := 0
+	if entry, ok := idx.entries[term]; ok {
+		df = len(entry.DocIDs)
+	}
+	if idx.spill != nil {
+		df += idx.spill.terms[term].df
+	}
+	return df - idx.removed[term]
+}
+
+func (idx *Index) dictionary(ctx context.Context) (*termDict, error) {
+	if idx.dict == nil {
+		terms := make([]string, 0, len(idx.surfaces))
+		for form := range idx.surfaces {
+			terms = append(terms, form)
+		}
+		dict, err := buildTermDict(ctx, terms)
+		if err != nil {
+			return nil, err
+		}
+		idx.dict = dict
+	}
+	return idx.dict, nil
 }
@@ -1,55 +1,153 @@
 package utils
 
 import (
-	"math"
+	"context"
+	"errors"
 	"runtime"
-	"sort"
 	"sync"
+	"sync/atomic"
 )
 
 // ConcurrentIndex is an inverted index with concurrent processing capabilities.
 // It maps tokens to document IDs and their frequencies.
+//
+// Documents are added as immutable segments published atomically once indexed,
+// so searches running meanwhile see either none or all of the documents of an Add.
 type ConcurrentIndex struct {
-	sync.RWMutex
-	entries  sync.Map // map[string]*ConcurrentIndexEntry
-	docCount int
+	sync.RWMutex                             // serializes Add and Clear
+	field        string                      // document field indexed
+	fields       map[string]*ConcurrentIndex // indexes of additional fields
+	current      atomic.Pointer[indexSnapshot]
+	config       indexConfig
+	storeDocs    bool // whether segments keep the stored fields of documents, false for fields
 }
 
 // NewConcurrentIndex creates a new ConcurrentIndex instance
-func NewConcurrentIndex() *ConcurrentIndex {
-	return &ConcurrentIndex{}
+func NewConcurrentIndex(opts ...IndexOption) *ConcurrentIndex {
+	idx := newConcurrentFieldIndex(FieldText, newIndexConfig(opts))
+	idx.storeDocs = true
+	idx.current.Store(emptySnapshot(idx))
+	return idx
+}
+
+// newConcurrentFieldIndex creates a ConcurrentIndex of a single document field,
+// along with the indexes of the additional fields configured in cfg. The snapshots
+// of field indexes are part of those of the index they belong to.
+func newConcurrentFieldIndex(field string, cfg indexConfig) *ConcurrentIndex {
+	idx := &ConcurrentIndex{
+		field:  field,
+		fields: make(map[string]*ConcurrentIndex),
+		config: cfg,
+	}
+	for _, f := range cfg.fields {
+		idx.fields[f.name] = newConcurrentFieldIndex(f.name, cfg.fieldConfig(f))
+	}
+	return idx
+}
+
+// snapshot returns the last published view of the index.
+func (idx *ConcurrentIndex) snapshot() *indexSnapshot {
+	return idx.current.Load()
 }
 
 func (idx *ConcurrentIndex) Clear() {
-	idx.entries.Range(func(key, value any) bool {
-		idx.entries.Delete(key)
-		return true
-	})
-	idx.docCount = 0
+	idx.Lock()
+	defer idx.Unlock()
+	idx.current.Store(emptySnapshot(idx))
+}
+
+// DocumentCount returns the number of documents indexed, replaced ones excluded.
+func (idx *ConcurrentIndex) DocumentCount() int {
+	return idx.snapshot().docCount
 }
 
 func (idx *ConcurrentIndex) Stats() IndexStats {
-	termCount := 0
-	idx.entries.Range(func(key, value any) bool {
-		termCount++
-		return true
+	s := idx.snapshot()
+	s.statsOnce.Do(func() {
+		s.stats = indexStats(s, s.vocabulary(), s.tokens())
 	})
-	return IndexStats{
-		DocumentCount: idx.docCount,
-		TermCount:     termCount,
-	}
+	return s.stats
+}
+
+// TermStats returns the statistics of an index term, as produced by the analyzer.
+func (idx *ConcurrentIndex) TermStats(term string) (TermStats, bool) {
+	return termStats(idx.snapshot(), term)
+}
+
+// TopTerms returns the statistics of the n index terms occurring most often.
+func (idx *ConcurrentIndex) TopTerms(n int) []TermStats {
+	s := idx.snapshot()
+	return topTerms(s, s.vocabulary(), n)
 }
 
 // Add adds documents to the ConcurrentIndex with TF-IDF scoring using parallel processing
 func (idx *ConcurrentIndex) Add(docs []*Document) {
+	idx.AddContext(context.Background(), docs)
+}
+
+// AddContext is like Add but stops adding documents once ctx is done, returning
+// ctx.Err(). The documents added until then, a prefix of docs, stay indexed.
+// It also returns the errors storing documents.
+func (idx *ConcurrentIndex) AddContext(ctx context.Context, docs []*Document) error {
 	if len(docs) == 0 {
-		return
+		return nil
 	}
 
-	// Update document count for IDF calculation
 	idx.Lock()
-	idx.docCount += len(docs)
-	idx.Unlock()
+	defer idx.Unlock()
+	s := idx.snapshot()
+	nextID := s.nextID
+	assignIDs(docs, &nextID)
+	next, err := idx.addSegment(ctx, s, docs)
+	replaced := replacedDocs(docs, next.has, s.id)
+	old, docErr := documents(replaced, nil, next.stores()...)
+	next = idx.withRemoved(next, old)
+	next.nextID = nextID
+	next.replaced = withReplaced(s.replaced, replaced)
+	idx.current.Store(next)
+	return errors.Join(err, docErr)
+}
+
+// withRemoved returns s with the replaced documents docs left out of its statistics
+// and those of its fields, recorded in a segment without documents, see removedStats.
+func (idx *ConcurrentIndex) withRemoved(s *indexSnapshot, docs []*Document) *indexSnapshot {
+	if len(docs) == 0 {
+		return s
+	}
+	seg := &segment{
+		entries:  make(map[string]IndexEntry),
+		surfaces: make(map[string]int),
+	}
+	if idx.storeDocs {
+		seg.store = newDocStore()
+		seg.keys = make(map[string]int)
+	}
+	for _, doc := range docs {
+		seg.removed.add(&idx.config, idx.documentAnalyzer(doc), doc.Field(idx.config.documentField(idx.field)))
+	}
+
+	fields := make(map[string]*indexSnapshot, len(idx.fields))
+	for name, fieldIdx := range idx.fields {
+		fields[name] = fieldIdx.withRemoved(s.fields[name], docs)
+	}
+	return s.withSegment(seg, fields)
+}
+
+// addSegment indexes docs in a new segment and returns the snapshot s with it,
+// along with ctx.Err() if ctx is done before all of docs are indexed and the
+// errors storing documents.
+func (idx *ConcurrentIndex) addSegment(ctx context.Context, s *indexSnapshot, docs []*Document) (*indexSnapshot, error) {
+	seg := &segment{
+		entries:  make(map[string]IndexEntry),
+		surfaces: make(map[string]int),
+	}
+	if idx.storeDocs {
+		seg.store = newDocStore()
+		seg.keys = make(map[string]int)
+	}
+	var entries sync.Map // map[string]*ConcurrentIndexEntry
+	var mu sync.Mutex    // guards seg and storeErrs while workers merge into it
+	var storeErrs []error
 
 	// Process documents in parallel
 	var wg sync.WaitGroup
@@ -61,25 +159,48 @@ func (idx *ConcurrentIndex) Add(docs []*Document) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
+			// Documents and surface forms are collected per worker and merged once the worker is done.
+			// Documents are stored then, once their language is detected.
+			var stored []*Document
+			surfaces := make(map[string]int)
+			var tokenCount int64
+			defer func() {
+				mu.Lock()
+				for _, doc := range stored {
+					if err := seg.store.add(doc); err != nil {
+						storeErrs = append(storeErrs, err)
+					}
+					if doc.Key != "" {
+						seg.keys[doc.Key] = max(seg.keys[doc.Key], doc.ID)
+					}
+				}
+				for form, df := range surfaces {
+					seg.surfaces[form] += df
+				}
+				seg.tokens += tokenCount
+				mu.Unlock()
+			}()
+
 			for doc := range docChan {
+				if seg.store != nil {
+					stored = append(stored, doc)
+				}
 
-				// Count token frequencies in document
-				tokenFreq := make(map[string]int)
-				tokens := analyze(doc.Text)
-				totalTokens := len(tokens)
-				if totalTokens == 0 {
+				surface, tokens, totalTokens := analyzeDocument(&idx.config, idx.documentAnalyzer(doc), doc.Field(idx.config.documentField(idx.field)))
+				if len(tokens) == 0 {
 					continue
 				}
+				tokenCount += int64(totalTokens)
 
-				// Calculate term frequencies
-				for _, token := range tokens {
-					tokenFreq[token]++
+				// Record unstemmed forms for spelling suggestions
+				for _, form := range uniqueTokens(surface) {
+					surfaces[form]++
 				}
 
 				// Update index with document frequencies
-				for token, freq := range tokenFreq {
+				for token, termPos := range termPositions(tokens) {
 					// Ensure ConcurrentIndexEntry is created with float32 slice
-					entry, _ := idx.entries.LoadOrStore(token, &ConcurrentIndexEntry{
+					entry, _ := entries.LoadOrStore(token, &ConcurrentIndexEntry{
 						DocIDs: make([]int, 0, 64),
 						Freqs:  make([]float32, 0, 64), // Use float32
 					})
@@ -90,76 +211,173 @@ func (idx *ConcurrentIndex) Add(docs []*Document) {
 					indexEntry.DocIDs = append(indexEntry.DocIDs, doc.ID)
 					// Calculate TF as frequency / total tokens in document
 					// Cast result to float32 before appending
-					tf := float32(float64(freq) / float64(totalTokens))
+					tf := float32(float64(len(termPos)) / float64(totalTokens))
 					indexEntry.Freqs = append(indexEntry.Freqs, tf) // Append float32
+					indexEntry.Positions.add(termPos)
 					indexEntry.Unlock()
 				}
 			}
 		}()
 	}
 
+	// Feed documents in order until ctx is done, so the added ones are a prefix of docs
+	added := 0
+	var err error
+feed:
 	for _, doc := range docs {
-		docChan <- doc
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		select {
+		case docChan <- doc:
+			added++
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
 	}
 	close(docChan)
 	wg.Wait()
 
+	// The postings are final once the workers are done
+	entries.Range(func(key, value any) bool {
+		entry := value.(*ConcurrentIndexEntry)
+		seg.entries[key.(string)] = sortPostings(IndexEntry{DocIDs: entry.DocIDs, Freqs: entry.Freqs, Positions: entry.Positions})
+		return true
+	})
+	seg.docCount = added
+	if seg.store != nil {
+		storeErrs = append(storeErrs, seg.store.flush())
+	}
+
+	// Field indexes get every added document, even once ctx is done
+	fields := make(map[string]*indexSnapshot, len(idx.fields))
+	for name, fieldIdx := range idx.fields {
+		fields[name], _ = fieldIdx.addSegment(context.WithoutCancel(ctx), s.fields[name], docs[:added])
+	}
+
 	// TF is stored directly, IDF calculated during Search
-	// idx.calculateIDF()
+	return s.withSegment(seg, fields), errors.Join(append(storeErrs, err)...)
 }
 
-// Search queries the ConcurrentIndex for the given text and returns scored results
-func (idx *ConcurrentIndex) Search(text string) []SearchResult {
-	tokens := analyze(text)
-	if len(tokens) == 0 {
-		return nil
+// documentAnalyzer returns the analyzer for doc, detecting its language first if needed.
+func (idx *ConcurrentIndex) documentAnalyzer(doc *Document) Analyzer {
+	if idx.config.detector == nil {
+		return idx.config.analyzer
+	}
+	if doc.Lang == "" {
+		doc.Lang = idx.config.detector.Detect(doc.Text)
 	}
+	return idx.config.analyzerFor(doc.Lang)
+}
 
-	scores := make(map[int]float32)
-	var scoresMutex sync.RWMutex
+// SurfaceForms returns the unstemmed terms seen while indexing, mapped to the
+// number of documents containing them.
+func (idx *ConcurrentIndex) SurfaceForms() map[string]int {
+	return idx.snapshot().surfaceForms()
+}
 
-	// Calculate scores for each token
-	for _, token := range tokens {
-		if entry, ok := idx.entries.Load(token); ok {
-			indexEntry := entry.(*ConcurrentIndexEntry)
-			indexEntry.RLock()
+// Search queries the ConcurrentIndex for the given text and returns scored results.
+// Queries that cannot be evaluated return no results, use Query to get the error.
+func (idx *ConcurrentIndex) Search(text string) []SearchResult {
+	results, _ := idx.Query(text)
+	return results
+}
 
-			// Calculate IDF for the current term
-			// Must read docCount within the lock to ensure consistency if Add is running concurrently
-			// Use RLock on the main index to safely read docCount
-			idx.RLock()
-			docCount := idx.docCount
-			idx.RUnlock()
+// Query is like Search but reports queries that cannot be evaluated,
+// such as a prefix matching more terms than the maximum expansion count.
+func (idx *ConcurrentIndex) Query(text string) ([]SearchResult, error) {
+	return search(context.Background(), idx.snapshot(), text, 0)
+}
 
-			// IDF = log(N/(df + 1)) + 1
-			idf := float32(math.Log(float64(docCount)/(float64(len(indexEntry.DocIDs))+1.0)) + 1.0)
+// SearchContext is like Query but stops scoring once ctx is done. The documents
+// scored until then are returned as a timed out response if opts allows partial
+// results, otherwise ctx.Err() is returned.
+func (idx *ConcurrentIndex) SearchContext(ctx context.Context, text string, opts SearchOptions) (SearchResponse, error) {
+	return searchContext(ctx, idx.snapshot(), text, opts)
+}
 
-			for i, docID := range indexEntry.DocIDs {
-				scoresMutex.Lock()
-				// Score is TF (from entry.Freqs) * IDF (calculated now)
-				scores[docID] += indexEntry.Freqs[i] * idf
-				scoresMutex.Unlock()
-			}
-			indexEntry.RUnlock()
-		}
+// Explain returns how the score of docID for the query text is computed. Its value
+// is the score of the document in the results of Search, or zero if it does not match.
+func (idx *ConcurrentIndex) Explain(text string, docID int) (Explanation, error) {
+	s := idx.snapshot()
+	if !s.has(docID) || !s.live(docID) {
+		return Explanation{}, ErrDocumentNotFound
 	}
+	return explain(s, text, docID)
+}
 
-	if len(scores) == 0 {
-		return nil
+// Analyzer returns the analyzer used for indexed documents and queries.
+func (idx *ConcurrentIndex) Analyzer() Analyzer {
+	return idx.config.analyzer
+}
+
+// FieldAnalyzer returns the analyzer used for queries on field, if it is indexed.
+func (idx *ConcurrentIndex) FieldAnalyzer(field string) (Analyzer, bool) {
+	return idx.config.fieldAnalyzer(field)
+}
+
+// LanguageAnalyzer returns the analyzer used for documents and queries in lang,
+// if the index detects languages.
+func (idx *ConcurrentIndex) LanguageAnalyzer(lang Language) (Analyzer, bool) {
+	return idx.config.languageAnalyzer(lang)
+}
+
+func (idx *ConcurrentIndex) searchWorkers() int {
+	if idx.config.searchWorkers > 0 {
+		return idx.config.searchWorkers
 	}
+	return runtime.NumCPU()
+}
 
-	results := make([]SearchResult, 0, len(scores))
-	for docID, score := range scores {
-		results = append(results, SearchResult{
-			DocID: docID,
-			Score: score,
-		})
+// MoreLikeThis returns the documents most similar to the indexed document docID,
+// excluding the document itself.
+func (idx *ConcurrentIndex) MoreLikeThis(docID int, opts MoreLikeThisOptions) ([]SearchResult, error) {
+	s := idx.snapshot()
+	docs, err := documents([]int{docID}, s.replaced, s.stores()...)
+	if err != nil {
+		return nil, err
 	}
+	return moreLikeThis(s, docs[0].Text, docID, opts), nil
+}
 
-	// Sort results by score (highest first)
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Score > results[j].Score
-	})
+// Get returns the stored document docID, or ErrDocumentNotFound if it is not indexed.
+func (idx *ConcurrentIndex) Get(docID int) (*Document, error) {
+	docs, err := idx.GetMany([]int{docID})
+	if err != nil {
+		return nil, err
+	}
+	return docs[0], nil
+}
 
-	return results
+// GetMany returns the stored documents ids, in order, or ErrDocumentNotFound
+// if one of them is not indexed.
+func (idx *ConcurrentIndex) GetMany(ids []int) ([]*Document, error) {
+	s := idx.snapshot()
+	return documents(ids, s.replaced, s.stores()...)
+}
+
+// IDs returns the IDs of the indexed documents, in increasing order.
+func (idx *ConcurrentIndex) IDs() []int {
+	s := idx.snapshot()
+	return storedIDs(s.replaced, s.stores()...)
+}
+
+// ID returns the internal ID of the document indexed with key, if any.
+func (idx *ConcurrentIndex) ID(key string) (int, bool) {
+	return idx.snapshot().id(key)
+}
+
+// Key returns the key of the document docID, if it is indexed with one.
+func (idx *ConcurrentIndex) Key(docID int) (string, bool) {
+	doc, err := idx.Get(docID)
+	if err != nil || doc.Key == "" {
+		return "", false
+	}
+	return doc.Key, true
+}
+
+// MoreLikeThisText returns the documents most similar to text.
+func (idx *ConcurrentIndex) MoreLikeThisText(text string, opts MoreLikeThisOptions) []SearchResult {
+	return moreLikeThis(idx.snapshot(), text, -1, opts)
 }
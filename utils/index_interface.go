@@ -1,26 +1,109 @@
 package utils
 
+import "context"
+
 // Indexer defines the interface for full-text search index implementations
 type Indexer interface {
 	// Add adds documents to the index and updates TF-IDF scores
 	Add(docs []*Document)
 
+	// AddContext adds documents like Add until ctx is done, keeping the ones added so far.
+	// Documents with a key are given the next IDs and replace the document indexed with
+	// the same key, which is then left out of results and scoring statistics. Documents
+	// without one keep their ID unless an earlier document took it, see Document.ID.
+	AddContext(ctx context.Context, docs []*Document) error
+
 	// Search performs a full-text search and returns scored results
 	Search(text string) []SearchResult
 
-	// Stats returns statistics about the index
+	// Query performs a full-text search like Search, reporting queries that cannot be evaluated
+	Query(text string) ([]SearchResult, error)
+
+	// SearchContext performs a full-text search like Query that stops once ctx is done
+	SearchContext(ctx context.Context, text string, opts SearchOptions) (SearchResponse, error)
+
+	// Explain returns how the score of a document for a query is computed
+	Explain(text string, docID int) (Explanation, error)
+
+	// MoreLikeThis returns the documents most similar to an indexed document, excluding it
+	MoreLikeThis(docID int, opts MoreLikeThisOptions) ([]SearchResult, error)
+
+	// MoreLikeThisText returns the documents most similar to an arbitrary piece of text
+	MoreLikeThisText(text string, opts MoreLikeThisOptions) []SearchResult
+
+	// Get returns a stored document
+	Get(docID int) (*Document, error)
+
+	// GetMany returns stored documents, in the order of the given IDs
+	GetMany(ids []int) ([]*Document, error)
+
+	// IDs returns the IDs of the indexed documents, in increasing order
+	IDs() []int
+
+	// ID returns the internal ID of the document indexed with an external key
+	ID(key string) (int, bool)
+
+	// Key returns the external key of an indexed document
+	Key(docID int) (string, bool)
+
+	// SurfaceForms returns the unstemmed terms seen while indexing with their document frequencies
+	SurfaceForms() map[string]int
+
+	// Analyzer returns the analyzer used for indexed documents and queries
+	Analyzer() Analyzer
+
+	// Stats returns statistics about the index, computed from every posting once per change
 	Stats() IndexStats
 
+	// TermStats returns statistics about an index term, if it is indexed
+	TermStats(term string) (TermStats, bool)
+
+	// TopTerms returns statistics about the n index terms occurring most often
+	TopTerms(n int) []TermStats
+
 	// Clear removes all documents from the index
 	Clear()
 }
 
+// AnalyzerLookup is implemented by indexes reporting the analyzers of their fields
+// and languages, for tools showing how text is analyzed
+type AnalyzerLookup interface {
+	// FieldAnalyzer returns the analyzer used for queries on a field, if it is indexed
+	FieldAnalyzer(field string) (Analyzer, bool)
+
+	// LanguageAnalyzer returns the analyzer used for documents and queries in a language,
+	// if the index detects languages, see WithLanguageDetection
+	LanguageAnalyzer(lang Language) (Analyzer, bool)
+}
+
+// DocumentCounter is implemented by indexes counting their documents without
+// walking the postings like Stats
+type DocumentCounter interface {
+	// DocumentCount returns the number of documents indexed
+	DocumentCount() int
+}
+
 // IndexStats contains statistics about the index
 type IndexStats struct {
 	DocumentCount int     // Total number of documents
 	TermCount     int     // Total number of unique terms
 	AvgDocLength  float64 // Average document length (in terms)
-	MaxScore      float64 // Maximum score in the index
-	MinScore      float64 // Minimum score in the index
+	MaxScore      float64 // Maximum score of a term in a document (TF * IDF)
+	MinScore      float64 // Minimum score of a term in a document (TF * IDF)
 	IndexSizeKB   int64   // Approximate size of the index in KB
+
+	Spills          int   // Number of postings runs spilled to disk, see WithMemoryBudget
+	PeakMemoryBytes int64 // Peak estimated size of the postings held in memory while indexing
+}
+
+// SearchOptions configures SearchContext
+type SearchOptions struct {
+	AllowPartialResults bool // Return the results scored so far instead of an error when the context is done
+	Limit               int  // Maximum number of results, the best scoring ones, or 0 for all
+}
+
+// SearchResponse is the result of SearchContext
+type SearchResponse struct {
+	Results  []SearchResult // Scored results, sorted by score
+	TimedOut bool           // The context was done before scoring finished, Results are partial
 }
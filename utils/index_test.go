@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -28,7 +30,7 @@ func TestIndex(t *testing.T) {
 	results := idx.Search("donut")
 	assert.Len(t, results, 1)
 	assert.Equal(t, 1, results[0].DocID)
-	assert.Greater(t, results[0].Score, 0.0)
+	assert.Greater(t, results[0].Score, float32(0))
 
 	// Test case insensitivity and stemming
 	results = idx.Search("DONUTS")
@@ -170,3 +172,399 @@ func BenchmarkIndexAddLarge(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkSearch(b *testing.B) {
+	docs := generateLargeDataset(100000)
+	indexes := []struct {
+		name string
+		idx  Indexer
+	}{
+		{"SimpleIndex", NewIndex()},
+		{"ConcurrentIndex", NewConcurrentIndex()},
+	}
+	for _, ix := range indexes {
+		ix.idx.Add(docs)
+	}
+
+	for _, query := range []string{"quick jump", "five box quick judge", `"quick brown fox"`, "qu* jump"} {
+		for _, ix := range indexes {
+			b.Run(ix.name+"/"+query, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					ix.idx.Search(query)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkSearchWorkers compares the scoring of large queries by several workers
+func BenchmarkSearchWorkers(b *testing.B) {
+	docs := generateLargeDataset(100000)
+	for _, workers := range []int{1, 2, 4, 8} {
+		idx := NewConcurrentIndex(WithSearchWorkers(workers))
+		idx.Add(docs)
+		for _, query := range []string{"quick jump", `"quick brown fox"`} {
+			b.Run(fmt.Sprintf("%d/%s", workers, query), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					idx.Search(query)
+				}
+			})
+		}
+	}
+}
+
+// TestParallelSearch checks that queries scored by several workers find the same results
+func TestParallelSearch(t *testing.T) {
+	docs := generateLargeDataset(2 * minParallelPostings)
+	idx := NewIndex()
+	idx.Add(docs)
+	// Documents added in several segments, each worker scoring a range of their IDs
+	concurrentIdx := NewConcurrentIndex(WithSearchWorkers(3))
+	for i := 0; i < len(docs); i += 5000 {
+		concurrentIdx.Add(docs[i:min(i+5000, len(docs))])
+	}
+	moreWorkers := NewConcurrentIndex(WithSearchWorkers(7))
+	moreWorkers.Add(docs)
+
+	scores := func(results []SearchResult) map[int]float32 {
+		m := make(map[int]float32, len(results))
+		for _, result := range results {
+			m[result.DocID] = result.Score
+		}
+		return m
+	}
+
+	for _, query := range []string{"quick jump", "five box quick judge", `"quick brown fox"`, "qu* jump"} {
+		results := idx.Search(query)
+		assert.NotEmpty(t, results, query)
+		assert.Equal(t, scores(results), scores(concurrentIdx.Search(query)), query)
+		assert.Equal(t, scores(results), scores(moreWorkers.Search(query)), query)
+
+		// The best results are kept when merging those of the workers
+		for _, ix := range []Indexer{idx, concurrentIdx} {
+			resp, err := ix.SearchContext(context.Background(), query, SearchOptions{Limit: 10})
+			assert.NoError(t, err)
+			if assert.Len(t, resp.Results, 10, query) {
+				assert.Equal(t, results[0].Score, resp.Results[0].Score, query)
+				assert.Equal(t, results[9].Score, resp.Results[9].Score, query)
+			}
+		}
+	}
+}
+
+// TestFuzzySearch tests term~N queries on both index implementations
+func TestFuzzySearch(t *testing.T) {
+	docs := []*Document{
+		{ID: 1, Text: "Albert Einstein developed the theory of relativity"},
+		{ID: 2, Text: "Einsteinium is a synthetic element"},
+		{ID: 3, Text: "Frankenstein is a novel by Mary Shelley"},
+	}
+
+	for _, idx := range []Indexer{NewIndex(), NewConcurrentIndex()} {
+		idx.Add(docs)
+
+		// Without fuzzy syntax a misspelled term finds nothing
+		assert.Empty(t, idx.Search("einstien"))
+
+		// A transposition is a single edit
+		results := idx.Search("einstien~1")
+		assert.Len(t, results, 1)
+		assert.Equal(t, 1, results[0].DocID)
+
+		// Exact matches score higher than corrections
+		exact := idx.Search("einstein~1")
+		assert.Len(t, exact, 1)
+		assert.Greater(t, exact[0].Score, results[0].Score)
+
+		// The edit distance bounds the expansion
+		assert.Empty(t, idx.Search("einstien~0"))
+		results = idx.Search("relativty~")
+		assert.Len(t, results, 1)
+		assert.Equal(t, 1, results[0].DocID)
+	}
+}
+
+// TestMultiTermSearch tests prefix, wildcard and range queries on both index implementations
+func TestMultiTermSearch(t *testing.T) {
+	docs := []*Document{
+		{ID: 1, Text: "Quantum mechanics describes nature at small scales"},
+		{ID: 2, Text: "The quantity of matter in a body"},
+		{ID: 3, Text: "A test of the emergency broadcast system"},
+		{ID: 4, Text: "Plain text files"},
+	}
+
+	for _, idx := range []Indexer{NewIndex(WithMaxExpansions(3)), NewConcurrentIndex(WithMaxExpansions(3))} {
+		idx.Add(docs)
+
+		results := idx.Search("quant*")
+		assert.Len(t, results, 2)
+		assert.ElementsMatch(t, []int{1, 2}, []int{results[0].DocID, results[1].DocID})
+
+		results = idx.Search("te?t")
+		assert.Len(t, results, 2)
+		assert.ElementsMatch(t, []int{3, 4}, []int{results[0].DocID, results[1].DocID})
+
+		results = idx.Search("[matter TO mechanics]")
+		assert.Len(t, results, 2)
+		assert.ElementsMatch(t, []int{1, 2}, []int{results[0].DocID, results[1].DocID})
+
+		// Expanding to more terms than allowed is reported as an error
+		results, err := idx.Query("*")
+		assert.ErrorIs(t, err, ErrTooManyExpansions)
+		assert.Empty(t, results)
+		assert.Empty(t, idx.Search("*"))
+	}
+}
+
+// TestCJKSearch tests searching text written without spaces between words
+func TestCJKSearch(t *testing.T) {
+	docs := []*Document{
+		{ID: 1, Text: "東京都は日本の首都である。"},
+		{ID: 2, Text: "京都市は京都府の府庁所在地である。"},
+		{ID: 3, Text: "กรุงเทพมหานครเป็นเมืองหลวงของประเทศไทย"},
+	}
+
+	for _, idx := range []Indexer{NewIndex(), NewConcurrentIndex()} {
+		idx.Add(docs)
+
+		results := idx.Search("首都")
+		assert.Len(t, results, 1)
+		assert.Equal(t, 1, results[0].DocID)
+
+		// "京都" is part of "東京都" as well
+		results = idx.Search("京都")
+		assert.Len(t, results, 2)
+		assert.Equal(t, 2, results[0].DocID)
+
+		results = idx.Search("日本")
+		assert.Len(t, results, 1)
+		assert.Equal(t, 1, results[0].DocID)
+
+		results = idx.Search("เมืองหลวง")
+		assert.Len(t, results, 1)
+		assert.Equal(t, 3, results[0].DocID)
+	}
+}
+
+// TestPhraseSearch tests quoted phrase queries on both index implementations
+func TestPhraseSearch(t *testing.T) {
+	docs := []*Document{
+		{ID: 1, Text: "The theory of general relativity"},
+		{ID: 2, Text: "General theories of everything"},
+		{ID: 3, Text: "Relativity, in general"},
+	}
+
+	for _, idx := range []Indexer{NewIndex(), NewConcurrentIndex()} {
+		idx.Add(docs)
+
+		// Terms must be adjacent and in order
+		results := idx.Search(`"general relativity"`)
+		assert.Len(t, results, 1)
+		assert.Equal(t, 1, results[0].DocID)
+
+		results = idx.Search(`"general theory"`)
+		assert.Len(t, results, 1)
+		assert.Equal(t, 2, results[0].DocID)
+
+		assert.Empty(t, idx.Search(`"relativity theory"`))
+		assert.Len(t, idx.Search(`"general"`), 3)
+
+		// Removed stop words leave gaps, matching any word
+		results = idx.Search(`"theory of general"`)
+		assert.Len(t, results, 1)
+		assert.Equal(t, 1, results[0].DocID)
+		assert.Len(t, idx.Search(`"theories and everything"`), 1)
+		assert.Empty(t, idx.Search(`"theory general"`))
+		assert.Empty(t, idx.Search(`"relativity general"`))
+	}
+}
+
+func TestPositionList(t *testing.T) {
+	var a, b PositionList
+	assert.Equal(t, 2, a.add([]int{0, 5}))
+	assert.Equal(t, 3, a.add([]int{200, 201}))
+	b.add([]int{7})
+	assert.Equal(t, []int{0, 5}, a.At(0))
+	assert.Equal(t, []int{200, 201}, a.At(1))
+	assert.Equal(t, 2, a.Count(1))
+
+	// Appending never changes the positions of dst
+	merged := appendPositions(a, b)
+	a.add([]int{9})
+	assert.Equal(t, 3, merged.Len())
+	assert.Equal(t, []int{200, 201}, merged.At(1))
+	assert.Equal(t, []int{7}, merged.At(2))
+	assert.Equal(t, []int{9}, a.At(2))
+}
+
+func TestEntitySearch(t *testing.T) {
+	docs := []*Document{
+		{ID: 1, Text: "Learn C++ and C# programming"},
+		{ID: 2, Text: "Contact user@example.com for details"},
+		{ID: 3, Text: "The value of pi is 3.14"},
+		{ID: 4, Text: "Send an e-mail, read the docs at https://go.dev/doc"},
+		{ID: 5, Text: "Chapter 3, verse 14"},
+	}
+
+	// Single-letter words are dropped by the default analyzer
+	plain := NewIndex()
+	plain.Add(docs)
+	assert.Empty(t, plain.Search("C++"))
+
+	analyzer := NewAnalyzerBuilder(NewEntityTokenizer(true)).
+		Filter(CharacterFilter, LowercaseFilter, EnglishStopwordFilter).
+		TermFilter(EnglishStemmerFilter).
+		Build()
+	for _, idx := range []Indexer{NewIndex(WithAnalyzer(analyzer)), NewConcurrentIndex(WithAnalyzer(analyzer))} {
+		idx.Add(docs)
+
+		for query, docID := range map[string]int{
+			"C++":                1,
+			"c#":                 1,
+			"user@example.com":   2,
+			"3.14":               3,
+			"e-mail":             4,
+			"https://go.dev/doc": 4,
+		} {
+			results := idx.Search(query)
+			if assert.Len(t, results, 1, query) {
+				assert.Equal(t, docID, results[0].DocID, query)
+			}
+		}
+
+		// Parts of entities are searchable too
+		assert.Equal(t, []int{2}, docIDs(idx.Search("example")))
+		assert.Equal(t, []int{4}, docIDs(idx.Search(`"go dev"`)))
+
+		// Numbers are not split
+		assert.Equal(t, []int{5}, docIDs(idx.Search("14")))
+	}
+}
+
+// expiringContext is a context that is done after its Err method has been called n times.
+type expiringContext struct {
+	context.Context
+	n int
+}
+
+func (ctx *expiringContext) Err() error {
+	if ctx.n--; ctx.n < 0 {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func TestSearchContext(t *testing.T) {
+	docs := make([]*Document, 0, 2*checkInterval)
+	for i := range cap(docs) {
+		text := "cat"
+		if i%2 == 0 {
+			text = "cat dog"
+		}
+		docs = append(docs, &Document{ID: i, Text: text})
+	}
+
+	for _, idx := range []Indexer{NewIndex(), NewConcurrentIndex()} {
+		idx.Add(docs)
+
+		resp, err := idx.SearchContext(context.Background(), "cat dog", SearchOptions{})
+		assert.NoError(t, err)
+		assert.False(t, resp.TimedOut)
+		assert.ElementsMatch(t, idx.Search("cat dog"), resp.Results)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = idx.SearchContext(ctx, "cat dog", SearchOptions{})
+		assert.ErrorIs(t, err, context.Canceled)
+		resp, err = idx.SearchContext(ctx, "cat dog", SearchOptions{AllowPartialResults: true})
+		assert.NoError(t, err)
+		assert.True(t, resp.TimedOut)
+		assert.Empty(t, resp.Results)
+
+		// Expire after expanding the query and scoring "cat", before "dog"
+		resp, err = idx.SearchContext(&expiringContext{Context: context.Background(), n: 3}, "cat dog", SearchOptions{AllowPartialResults: true})
+		assert.NoError(t, err)
+		assert.True(t, resp.TimedOut)
+		assert.ElementsMatch(t, idx.Search("cat"), resp.Results)
+
+		// Expire while building the dictionary for a fuzzy query, left to the next one
+		idx.Add([]*Document{{ID: len(docs), Text: "cats"}})
+		_, err = idx.SearchContext(&expiringContext{Context: context.Background(), n: 1}, "cat~1", SearchOptions{})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Len(t, idx.Search("cat~1"), len(docs)+1)
+	}
+}
+
+func TestAddContext(t *testing.T) {
+	docs := []*Document{
+		{ID: 0, Title: "Cats", Text: "The cat sat on the mat"},
+		{ID: 1, Title: "Dogs", Text: "A dog chased the cat"},
+		{ID: 2, Title: "Birds", Text: "Birds sing in the morning"},
+	}
+
+	for _, idx := range []Indexer{NewIndex(WithField(FieldTitle, NewEnglishAnalyzer())), NewConcurrentIndex(WithField(FieldTitle, NewEnglishAnalyzer()))} {
+		assert.NoError(t, idx.AddContext(context.Background(), docs[:1]))
+		assert.Equal(t, 1, idx.Stats().DocumentCount)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, idx.AddContext(ctx, docs[1:]), context.Canceled)
+		assert.Equal(t, 1, idx.Stats().DocumentCount)
+		assert.Empty(t, idx.Search("dog"))
+		assert.Equal(t, []int{0}, docIDs(idx.Search("title:cats")))
+	}
+}
+
+// TestConcurrentAddSearch checks that searches running during Add see the documents
+// of whole batches, with statistics matching them. Run it with -race.
+func TestConcurrentAddSearch(t *testing.T) {
+	const batches, batchSize = 50, 20
+	idx := NewConcurrentIndex(WithField(FieldTitle, NewEnglishAnalyzer()))
+	batch := func(b int) []*Document {
+		docs := make([]*Document, batchSize)
+		for i := range docs {
+			docs[i] = &Document{ID: b*batchSize + i, Title: "Stress", Text: "stress test document"}
+		}
+		return docs
+	}
+	idx.Add(batch(0))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for b := 1; b < batches; b++ {
+			idx.Add(batch(b))
+		}
+	}()
+
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				// Every document matches, so they all score with the IDF of their number
+				results := idx.Search("stress")
+				n := len(results)
+				if !assert.Zero(t, n%batchSize, "partial batch") {
+					return
+				}
+				for _, result := range results {
+					if !assert.Equal(t, float32(1.0/3.0)*inverseDocFreq(n, n), result.Score) {
+						return
+					}
+				}
+
+				// Fields are published along with the text, so documents match both or neither
+				results = idx.Search("stress title:stress")
+				assert.Zero(t, len(results)%batchSize, "partial batch")
+				assert.Equal(t, results[0].Score, results[len(results)-1].Score)
+				assert.Zero(t, idx.SurfaceForms()["stress"]%batchSize)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, idx.Search("stress"), batches*batchSize)
+	assert.Equal(t, batches*batchSize, idx.Stats().DocumentCount)
+}
@@ -0,0 +1,96 @@
+package utils
+
+// assignIDs gives the documents of docs with a key the next internal IDs from
+// *next, in order, and moves *next past the IDs of the documents without one.
+// Documents without a key whose ID was already assigned, or is taken by a later
+// ID, are given the next ID too, so they never overwrite another document.
+// IDs only increase, so the latest document added with a key has the highest ID.
+func assignIDs(docs []*Document, next *int) {
+	for _, doc := range docs {
+		if doc.Key != "" || doc.ID < *next {
+			doc.ID = *next
+		}
+		*next = doc.ID + 1
+	}
+}
+
+// replacedDocs returns the IDs of the documents replaced by the documents of docs
+// with a key that were added, as reported by added: those indexed before with the
+// same key, as returned by id, and earlier documents of docs with the same key.
+func replacedDocs(docs []*Document, added func(docID int) bool, id func(key string) (int, bool)) []int {
+	latest := make(map[string]int)
+	var replaced []int
+	for _, doc := range docs {
+		if doc.Key == "" || !added(doc.ID) {
+			continue
+		}
+		if prev, ok := latest[doc.Key]; ok {
+			replaced = append(replaced, prev)
+		} else if prev, ok := id(doc.Key); ok {
+			replaced = append(replaced, prev)
+		}
+		latest[doc.Key] = doc.ID
+	}
+	return replaced
+}
+
+// withReplaced returns the set of replaced document IDs with ids added. The set
+// is copied rather than modified, as published snapshots may still read it.
+func withReplaced(replaced map[int]struct{}, ids []int) map[int]struct{} {
+	if len(ids) == 0 {
+		return replaced
+	}
+	m := make(map[int]struct{}, len(replaced)+len(ids))
+	for id := range replaced {
+		m[id] = struct{}{}
+	}
+	for _, id := range ids {
+		m[id] = struct{}{}
+	}
+	return m
+}
+
+// removedStats holds the statistics of replaced documents. They are left out of
+// the statistics of their index, so that scores match those of an index built
+// without them; only their postings remain, skipped by searches.
+type removedStats struct {
+	docs     int
+	tokens   int64          // number of index terms of the documents
+	df       map[string]int // term -> number of documents containing it
+	surfaces map[string]int // unstemmed term -> document frequency
+}
+
+// add adds the statistics of a replaced document whose indexed field is text,
+// analyzed with a as it was when the document was indexed.
+func (r *removedStats) add(cfg *indexConfig, a Analyzer, text string) {
+	r.docs++
+	surface, tokens, length := analyzeDocument(cfg, a, text)
+	if len(tokens) == 0 {
+		return
+	}
+	if r.df == nil {
+		r.df, r.surfaces = make(map[string]int), make(map[string]int)
+	}
+	r.tokens += int64(length)
+	for _, form := range uniqueTokens(surface) {
+		r.surfaces[form]++
+	}
+	for term := range termPositions(tokens) {
+		r.df[term]++
+	}
+}
+
+// merge adds the statistics of other to r.
+func (r *removedStats) merge(other removedStats) {
+	if other.df != nil && r.df == nil {
+		r.df, r.surfaces = make(map[string]int), make(map[string]int)
+	}
+	r.docs += other.docs
+	r.tokens += other.tokens
+	for term, df := range other.df {
+		r.df[term] += df
+	}
+	for form, df := range other.surfaces {
+		r.surfaces[form] += df
+	}
+}
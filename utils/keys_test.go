@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocumentKeys(t *testing.T) {
+	for name, idx := range map[string]Indexer{
+		"Index":           NewIndex(),
+		"ConcurrentIndex": NewConcurrentIndex(),
+		"ShardedIndex":    NewShardedIndex(3),
+	} {
+		// Documents with a key get the next IDs, those without one keep theirs
+		docs := []*Document{
+			{ID: 100, Key: "fox", Text: "The quick brown fox"},
+			{ID: 100, Key: "dog", Text: "The lazy dog"},
+			{ID: 10, Text: "A quick movement of the enemy"},
+			{Key: "cat", Text: "The cat sat on the mat"},
+		}
+		idx.Add(docs)
+		assert.Equal(t, []int{0, 1, 10, 11}, []int{docs[0].ID, docs[1].ID, docs[2].ID, docs[3].ID}, name)
+
+		id, ok := idx.ID("dog")
+		assert.True(t, ok, name)
+		assert.Equal(t, 1, id, name)
+		key, ok := idx.Key(11)
+		assert.True(t, ok, name)
+		assert.Equal(t, "cat", key, name)
+		_, ok = idx.ID("bird")
+		assert.False(t, ok, name)
+		_, ok = idx.Key(10)
+		assert.False(t, ok, name, "document without a key")
+
+		// Adding a key again replaces its document, as do later documents of the same Add
+		idx.Add([]*Document{
+			{Key: "dog", Text: "The lazy dog sleeps"},
+			{Key: "cat", Text: "The quick cat"},
+			{Key: "cat", Text: "The quick black cat"},
+		})
+		id, _ = idx.ID("dog")
+		assert.Equal(t, 12, id, name)
+		id, _ = idx.ID("cat")
+		assert.Equal(t, 14, id, name)
+
+		doc, err := idx.Get(12)
+		assert.NoError(t, err, name)
+		assert.Equal(t, "The lazy dog sleeps", doc.Text, name)
+		assert.Equal(t, "dog", doc.Key, name)
+		_, err = idx.Get(1)
+		assert.ErrorIs(t, err, ErrDocumentNotFound, name)
+		_, err = idx.Explain("lazy", 1)
+		assert.ErrorIs(t, err, ErrDocumentNotFound, name)
+		_, ok = idx.Key(13)
+		assert.False(t, ok, name, "replaced document")
+
+		ids := func(results []SearchResult) []int {
+			var ids []int
+			for _, result := range results {
+				ids = append(ids, result.DocID)
+			}
+			return ids
+		}
+		assert.Equal(t, []int{12}, ids(idx.Search("lazy")), name)
+		assert.ElementsMatch(t, []int{0, 10, 14}, ids(idx.Search("quick")), name)
+		assert.Empty(t, ids(idx.MoreLikeThisText("sat on the mat", MoreLikeThisOptions{})), name)
+		assert.Equal(t, 4, idx.Stats().DocumentCount, name)
+		assert.Equal(t, []int{0, 10, 12, 14}, idx.IDs(), name)
+
+		idx.Clear()
+		assert.Empty(t, idx.IDs(), name)
+		_, ok = idx.ID("dog")
+		assert.False(t, ok, name)
+		more := []*Document{{Key: "dog", Text: "The lazy dog"}}
+		idx.Add(more)
+		assert.Equal(t, 0, more[0].ID, name)
+		assert.Equal(t, []int{0}, ids(idx.Search("lazy")), name)
+	}
+}
+
+func TestMixedKeyedDocuments(t *testing.T) {
+	for name, idx := range map[string]Indexer{
+		"Index":           NewIndex(),
+		"ConcurrentIndex": NewConcurrentIndex(),
+		"ShardedIndex":    NewShardedIndex(3),
+	} {
+		idx.Add([]*Document{{Key: "k1", Text: "apple"}, {Key: "k2", Text: "pear"}})
+
+		// IDs taken by keyed documents are not reused by documents without a key
+		docs := []*Document{{ID: 0, Text: "cherry"}, {ID: 7, Text: "plum"}, {ID: 3, Text: "fig"}}
+		idx.Add(docs)
+		assert.Equal(t, []int{2, 7, 8}, []int{docs[0].ID, docs[1].ID, docs[2].ID}, name)
+		idx.Add([]*Document{{Key: "k3", Text: "grape"}})
+		id, _ := idx.ID("k3")
+		assert.Equal(t, 9, id, name)
+
+		assert.Equal(t, []int{0}, docIDs(idx.Search("apple")), name)
+		assert.Equal(t, []int{2}, docIDs(idx.Search("cherry")), name)
+		id, ok := idx.ID("k1")
+		assert.True(t, ok, name)
+		assert.Equal(t, 0, id, name)
+		key, ok := idx.Key(0)
+		assert.True(t, ok, name)
+		assert.Equal(t, "k1", key, name)
+		doc, err := idx.Get(2)
+		assert.NoError(t, err, name)
+		assert.Equal(t, "cherry", doc.Text, name)
+	}
+}
+
+func TestUpsertStatistics(t *testing.T) {
+	docs := func() []*Document {
+		return []*Document{
+			{Key: "a", Title: "Apple", Text: "apple pie"},
+			{Key: "b", Title: "Pear", Text: "pear tart with cream"},
+			{Key: "c", Title: "Pear and apple", Text: "pear and apple crumble"},
+		}
+	}
+	opts := []IndexOption{WithField(FieldTitle, NewEnglishAnalyzer())}
+	for name, newIndex := range map[string]func() Indexer{
+		"Index":           func() Indexer { return NewIndex(opts...) },
+		"ConcurrentIndex": func() Indexer { return NewConcurrentIndex(opts...) },
+		"ShardedIndex":    func() Indexer { return NewShardedIndex(3, opts...) },
+	} {
+		fresh := newIndex()
+		fresh.Add(docs())
+		idx := newIndex()
+		idx.Add(docs())
+		for range 50 {
+			idx.Add([]*Document{{Key: "b", Title: "Pear", Text: "pear tart with cream"}})
+		}
+		idx.Add(append(docs()[:1], docs()[:1]...))
+
+		// Replaced documents do not change the scores of the others
+		scores := func(idx Indexer, query string) map[string]float32 {
+			m := make(map[string]float32)
+			for _, result := range idx.Search(query) {
+				key, _ := idx.Key(result.DocID)
+				m[key] = result.Score
+			}
+			return m
+		}
+		for _, query := range []string{"apple", "pear", "title:pear", `"apple pie"`, "crea*"} {
+			assert.Equal(t, scores(fresh, query), scores(idx, query), name+" "+query)
+			for _, result := range idx.Search(query) {
+				e, err := idx.Explain(query, result.DocID)
+				assert.NoError(t, err, name+" "+query)
+				assert.Equal(t, result.Score, e.Value, name+" "+query)
+			}
+		}
+		similar := func(idx Indexer) map[string]float32 {
+			m := make(map[string]float32)
+			for _, result := range idx.MoreLikeThisText("pear and apple tart", MoreLikeThisOptions{}) {
+				key, _ := idx.Key(result.DocID)
+				m[key] = result.Score
+			}
+			return m
+		}
+		assert.NotEmpty(t, similar(fresh), name)
+		assert.Equal(t, similar(fresh), similar(idx), name)
+
+		want, got := fresh.Stats(), idx.Stats()
+		want.IndexSizeKB, got.IndexSizeKB = 0, 0 // postings of replaced documents remain
+		want.PeakMemoryBytes, got.PeakMemoryBytes = 0, 0
+		assert.Equal(t, want, got, name)
+		top := idx.TopTerms(3)
+		for i := range top {
+			top[i].PostingBytes = 0
+		}
+		assert.Equal(t, []TermStats{{Term: "appl", DocFreq: 2, TotalFreq: 2}, {Term: "pear", DocFreq: 2, TotalFreq: 2}, {Term: "cream", DocFreq: 1, TotalFreq: 1}}, top, name)
+		assert.Equal(t, fresh.SurfaceForms(), idx.SurfaceForms(), name)
+	}
+}
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// maxNgramLen is the length of the longest character n-gram used by LanguageDetector
+	maxNgramLen = 3
+
+	// minDetectLetters is the number of letters below which a text is too short
+	// for its language to be detected reliably
+	minDetectLetters = 10
+
+	// maxDetectRunes bounds the amount of text examined, the beginning of a
+	// document being enough to recognize its language
+	maxDetectRunes = 1000
+)
+
+// LanguageDetector identifies the language of a text offline, using a naive Bayes
+// classifier over the character n-grams (up to trigrams) of its words.
+type LanguageDetector struct {
+	langs    []Language                      // sorted, to break ties deterministically
+	profiles map[Language]map[string]float64 // n-gram -> log probability
+	unseen   map[Language]float64            // log probability of n-grams missing from a profile
+}
+
+// NewLanguageDetector creates a LanguageDetector recognizing the languages of
+// samples, each sample being text written in its language. Longer samples give
+// more accurate results.
+func NewLanguageDetector(samples map[Language]string) *LanguageDetector {
+	d := &LanguageDetector{
+		profiles: make(map[Language]map[string]float64, len(samples)),
+		unseen:   make(map[Language]float64, len(samples)),
+	}
+	for lang, sample := range samples {
+		counts := make(map[string]int)
+		total := 0
+		for _, gram := range ngrams(sample, -1) {
+			counts[gram]++
+			total++
+		}
+
+		// Add-one smoothing, with one extra slot for unseen n-grams
+		denom := math.Log(float64(total + len(counts) + 1))
+		profile := make(map[string]float64, len(counts))
+		for gram, count := range counts {
+			profile[gram] = math.Log(float64(count+1)) - denom
+		}
+		d.profiles[lang] = profile
+		d.unseen[lang] = -denom
+		d.langs = append(d.langs, lang)
+	}
+	sort.Slice(d.langs, func(i, j int) bool { return d.langs[i] < d.langs[j] })
+	return d
+}
+
+// DefaultLanguageDetector returns a detector for every language in Languages, built
+// from short samples compiled into the package.
+var DefaultLanguageDetector = sync.OnceValue(func() *LanguageDetector {
+	return NewLanguageDetector(languageSamples)
+})
+
+// Detect returns the most likely language of text, or "" if text is too short
+// to tell or the detector knows no language.
+func (d *LanguageDetector) Detect(text string) Language {
+	grams := ngrams(text, maxDetectRunes)
+	if len(grams) == 0 || letterCount(grams) < minDetectLetters {
+		return ""
+	}
+
+	var best Language
+	bestScore := math.Inf(-1)
+	for _, lang := range d.langs {
+		profile, unseen := d.profiles[lang], d.unseen[lang]
+		score := 0.0
+		for _, gram := range grams {
+			if p, ok := profile[gram]; ok {
+				score += p
+			} else {
+				score += unseen
+			}
+		}
+		if score > bestScore {
+			best, bestScore = lang, score
+		}
+	}
+	return best
+}
+
+// ngrams returns the character n-grams of the lower-cased words of text, each word
+// padded with spaces so that n-grams at word boundaries are distinct. At most
+// limit runes of text are read, unless limit is negative.
+func ngrams(text string, limit int) []string {
+	if limit >= 0 && utf8.RuneCountInString(text) > limit {
+		text = string([]rune(text)[:limit])
+	}
+
+	var grams []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !isWordRune(r) }) {
+		runes := []rune(" " + word + " ")
+		for n := 1; n <= maxNgramLen; n++ {
+			for i := 0; i+n <= len(runes); i++ {
+				if n == 1 && runes[i] == ' ' {
+					continue
+				}
+				grams = append(grams, string(runes[i:i+n]))
+			}
+		}
+	}
+	return grams
+}
+
+// letterCount returns the number of letters in text, given its n-grams: every
+// letter is one of the unigrams.
+func letterCount(grams []string) int {
+	count := 0
+	for _, gram := range grams {
+		if utf8.RuneCountInString(gram) == 1 {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,108 @@
+package utils
+
+// languageSamples are short texts used to build the character n-gram profiles
+// of the languages recognized by LanguageDetector.
+var languageSamples = map[Language]string{
+	English: `All human beings are born free and equal in dignity and rights. They are endowed
+with reason and conscience and should act towards one another in a spirit of brotherhood.
+The city is the capital and largest city of the country, with a population of more than
+two million people. It was founded in the twelfth century and became an important centre
+of trade during the following years. The river which flows through the town is one of the
+longest in the region. He was an American writer and journalist who worked for several
+newspapers before he published his first novel. The species is found in tropical forests,
+where it feeds on insects, fruit and small animals. The album was released by the band in
+the summer and reached the top of the charts within a week. This article is about the
+history of the kingdom, from its earliest known settlements to the present day, and the
+war that changed its borders. She was born in a small village and studied music at the
+university, where she later became a professor of composition.`,
+
+	French: `Tous les êtres humains naissent libres et égaux en dignité et en droits. Ils sont
+doués de raison et de conscience et doivent agir les uns envers les autres dans un esprit de
+fraternité. La ville est la capitale et la plus grande ville du pays, avec une population de
+plus de deux millions d'habitants. Elle a été fondée au douzième siècle et est devenue un
+centre important du commerce pendant les années suivantes. La rivière qui traverse la ville
+est l'une des plus longues de la région. Il était un écrivain et journaliste français qui a
+travaillé pour plusieurs journaux avant de publier son premier roman. L'espèce se trouve dans
+les forêts tropicales, où elle se nourrit d'insectes, de fruits et de petits animaux. L'album
+est sorti pendant l'été et a atteint la première place des ventes en une semaine. Cet article
+traite de l'histoire du royaume, depuis ses premiers établissements connus jusqu'à nos jours,
+et de la guerre qui a changé ses frontières. Elle est née dans un petit village et a étudié la
+musique à l'université, où elle est ensuite devenue professeur de composition.`,
+
+	Spanish: `Todos los seres humanos nacen libres e iguales en dignidad y derechos y, dotados
+como están de razón y conciencia, deben comportarse fraternalmente los unos con los otros. La
+ciudad es la capital y la ciudad más grande del país, con una población de más de dos millones
+de habitantes. Fue fundada en el siglo doce y se convirtió en un importante centro de comercio
+durante los años siguientes. El río que atraviesa la ciudad es uno de los más largos de la
+región. Fue un escritor y periodista español que trabajó para varios periódicos antes de
+publicar su primera novela. La especie se encuentra en los bosques tropicales, donde se
+alimenta de insectos, frutas y pequeños animales. El álbum fue publicado por la banda en el
+verano y llegó al primer puesto de las listas en una semana. Este artículo trata sobre la
+historia del reino, desde sus primeros asentamientos conocidos hasta la actualidad, y de la
+guerra que cambió sus fronteras. Ella nació en un pequeño pueblo y estudió música en la
+universidad, donde más tarde fue profesora de composición.`,
+
+	German: `Alle Menschen sind frei und gleich an Würde und Rechten geboren. Sie sind mit
+Vernunft und Gewissen begabt und sollen einander im Geist der Brüderlichkeit begegnen. Die
+Stadt ist die Hauptstadt und größte Stadt des Landes mit einer Bevölkerung von mehr als zwei
+Millionen Einwohnern. Sie wurde im zwölften Jahrhundert gegründet und entwickelte sich in den
+folgenden Jahren zu einem wichtigen Zentrum des Handels. Der Fluss, der durch die Stadt
+fließt, ist einer der längsten der Region. Er war ein deutscher Schriftsteller und Journalist,
+der für mehrere Zeitungen arbeitete, bevor er seinen ersten Roman veröffentlichte. Die Art
+kommt in tropischen Wäldern vor, wo sie sich von Insekten, Früchten und kleinen Tieren
+ernährt. Das Album wurde im Sommer von der Band veröffentlicht und erreichte innerhalb einer
+Woche die Spitze der Charts. Dieser Artikel behandelt die Geschichte des Königreichs von den
+frühesten bekannten Siedlungen bis zur Gegenwart und den Krieg, der seine Grenzen veränderte.
+Sie wurde in einem kleinen Dorf geboren und studierte Musik an der Universität, wo sie später
+Professorin für Komposition wurde.`,
+
+	Russian: `Все люди рождаются свободными и равными в своем достоинстве и правах. Они наделены
+разумом и совестью и должны поступать в отношении друг друга в духе братства. Город является
+столицей и крупнейшим городом страны с населением более двух миллионов человек. Он был основан
+в двенадцатом веке и стал важным центром торговли в последующие годы. Река, протекающая через
+город, является одной из самых длинных в регионе. Он был русским писателем и журналистом,
+который работал в нескольких газетах, прежде чем опубликовал свой первый роман. Этот вид
+встречается в тропических лесах, где питается насекомыми, фруктами и мелкими животными. Альбом
+был выпущен группой летом и в течение недели возглавил чарты. Эта статья посвящена истории
+королевства от самых ранних известных поселений до наших дней и войне, которая изменила его
+границы. Она родилась в маленькой деревне и изучала музыку в университете, где позже стала
+профессором композиции.`,
+
+	Swedish: `Alla människor är födda fria och lika i värde och rättigheter. De är utrustade med
+förnuft och samvete och bör handla gentemot varandra i en anda av broderskap. Staden är
+huvudstad och den största staden i landet, med en befolkning på mer än två miljoner
+invånare. Den grundades på tolvhundratalet och blev ett viktigt centrum för handel under de
+följande åren. Floden som rinner genom staden är en av de längsta i regionen. Han var en
+svensk författare och journalist som arbetade för flera tidningar innan han gav ut sin första
+roman. Arten förekommer i tropiska skogar, där den lever av insekter, frukt och små djur.
+Albumet släpptes av bandet under sommaren och nådde toppen av listorna inom en vecka. Den här
+artikeln handlar om rikets historia, från de tidigaste kända bosättningarna till nutid, och
+om kriget som förändrade dess gränser. Hon föddes i en liten by och studerade musik vid
+universitetet, där hon senare blev professor i komposition. Det är inte ovanligt att
+människor som bor här också talar flera språk.`,
+
+	Norwegian: `Alle mennesker er født frie og med samme menneskeverd og menneskerettigheter. De er
+utstyrt med fornuft og samvittighet og bør handle mot hverandre i brorskapets ånd. Byen er
+hovedstad og den største byen i landet, med en befolkning på mer enn to millioner
+innbyggere. Den ble grunnlagt på tolvhundretallet og ble et viktig senter for handel i de
+følgende årene. Elven som renner gjennom byen er en av de lengste i regionen. Han var en
+norsk forfatter og journalist som jobbet for flere aviser før han ga ut sin første roman.
+Arten finnes i tropiske skoger, hvor den lever av insekter, frukt og små dyr. Albumet ble
+gitt ut av bandet om sommeren og nådde toppen av listene i løpet av en uke. Denne artikkelen
+handler om kongerikets historie, fra de tidligste kjente bosetningene til i dag, og om
+krigen som endret grensene. Hun ble født i en liten landsby og studerte musikk ved
+universitetet, hvor hun senere ble professor i komposisjon. Det er ikke uvanlig at
+mennesker som bor her også snakker flere språk.`,
+
+	Hungarian: `Minden emberi lény szabadon születik és egyenlő méltósága és joga van. Az
+emberek, ésszel és lelkiismerettel bírván, egymással szemben testvéri szellemben kell hogy
+viseltessenek. A város az ország fővárosa és legnagyobb városa, több mint kétmillió lakossal.
+A tizenkettedik században alapították, és a következő években a kereskedelem fontos
+központjává vált. A városon átfolyó folyó a régió egyik leghosszabb folyója. Magyar író és
+újságíró volt, aki több újságnak dolgozott, mielőtt kiadta első regényét. A faj trópusi
+erdőkben él, ahol rovarokkal, gyümölcsökkel és kisebb állatokkal táplálkozik. Az albumot a
+zenekar nyáron adta ki, és egy héten belül a slágerlisták élére került. Ez a szócikk a
+királyság történetéről szól a legkorábbi ismert településektől napjainkig, valamint arról a
+háborúról, amely megváltoztatta a határait. Egy kis faluban született, és zenét tanult az
+egyetemen, ahol később a zeneszerzés professzora lett.`,
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLanguageDetector(t *testing.T) {
+	d := DefaultLanguageDetector()
+
+	testCases := []struct {
+		text string
+		lang Language
+	}{
+		{"The cat is sitting on the mat in the kitchen", English},
+		{"Le chat est assis sur le tapis de la cuisine", French},
+		{"El gato está sentado en la alfombra de la cocina", Spanish},
+		{"Die Katze sitzt auf der Matte in der Küche", German},
+		{"Кошка сидит на коврике на кухне", Russian},
+		{"Katten sitter på mattan i köket och väntar på mat", Swedish},
+		{"Katten sitter på matten på kjøkkenet og venter på mat", Norwegian},
+		{"A macska a konyhában ül a szőnyegen", Hungarian},
+		{"cat", ""},
+		{"", ""},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.lang, d.Detect(tc.text), tc.text)
+	}
+}
+
+func TestCustomLanguageDetector(t *testing.T) {
+	d := NewLanguageDetector(map[Language]string{
+		English: "the quick brown fox jumps over the lazy dog",
+		French:  "le renard brun rapide saute par-dessus le chien paresseux",
+	})
+	assert.Equal(t, French, d.Detect("le chien saute par-dessus le renard"))
+	assert.Equal(t, English, d.Detect("the lazy fox jumps over the dog"))
+
+	assert.Equal(t, Language(""), NewLanguageDetector(nil).Detect("the lazy fox jumps over the dog"))
+}
+
+func TestLanguageDetectionIndex(t *testing.T) {
+	newDocs := func() []*Document {
+		return []*Document{
+			{ID: 1, Text: "The cats are sleeping in the garden of the house"},
+			{ID: 2, Text: "Les chats dorment dans le jardin de la maison"},
+			{ID: 3, Text: "Кошки спят в саду около большого дома"},
+			{ID: 4, Text: "The gardens of the castle", Lang: French},
+		}
+	}
+
+	for _, idx := range []Indexer{NewIndex(WithLanguageDetection(nil)), NewConcurrentIndex(WithLanguageDetection(nil))} {
+		docs := newDocs()
+		idx.Add(docs)
+
+		// Documents are tagged with their language unless they already have one
+		assert.Equal(t, []Language{English, French, Russian, French},
+			[]Language{docs[0].Lang, docs[1].Lang, docs[2].Lang, docs[3].Lang})
+
+		// Each document is analyzed in its own language
+		results := idx.Search("кошка")
+		assert.Len(t, results, 1)
+		assert.Equal(t, 3, results[0].DocID)
+
+		// The language is a filter field
+		results = idx.Search("lang:fr jardin")
+		assert.Len(t, results, 1)
+		assert.Equal(t, 2, results[0].DocID)
+		assert.Empty(t, idx.Search("lang:en jardin"))
+		results = idx.Search("lang:en garden")
+		assert.Len(t, results, 1)
+		assert.Equal(t, 1, results[0].DocID)
+	}
+
+	// Queries long enough to be recognized are analyzed in their own language
+	idx := NewIndex(WithLanguageDetection(nil), WithQueryLanguageDetection())
+	idx.Add(newDocs())
+	results := idx.Search("les chats dorment")
+	assert.Len(t, results, 1)
+	assert.Equal(t, 2, results[0].DocID)
+	results = idx.Search("кошка")
+	assert.Len(t, results, 1)
+	assert.Equal(t, 3, results[0].DocID)
+}
+
+func TestLanguageDetectionStopwords(t *testing.T) {
+	docs := []*Document{
+		{ID: 1, Text: "The Who are an English rock band formed in London in 1964"},
+		{ID: 2, Text: "Les Who sont un groupe de rock anglais formé à Londres"},
+	}
+	english, _ := LanguageStopwords(English)
+	keep := func(Language) StopwordSet { return nil }
+	analyzer, _ := NewLanguageAnalyzerWithStopwords(English, nil)
+
+	// Kept stopwords are indexed in every language
+	idx := NewIndex(WithAnalyzer(analyzer), WithKeptStopwords(english), WithLanguageDetectionStopwords(nil, keep))
+	idx.Add(docs)
+	assert.Equal(t, []Language{English, French}, []Language{docs[0].Lang, docs[1].Lang})
+	results := idx.Search(`"the who"`)
+	assert.Len(t, results, 1)
+	assert.Equal(t, 1, results[0].DocID)
+	assert.Len(t, idx.Search(`"les who"`), 1)
+
+	// A custom list replaces the stopwords of every language
+	custom := func(Language) StopwordSet { return NewStopwords("rock") }
+	idx = NewIndex(WithLanguageDetectionStopwords(nil, custom))
+	idx.Add(docs)
+	assert.Empty(t, idx.Search("rock"))
+	assert.Len(t, idx.Search("les"), 1)
+}
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	snowballeng "github.com/kljensen/snowball/english"
+	snowballfr "github.com/kljensen/snowball/french"
+	snowballhu "github.com/kljensen/snowball/hungarian"
+	snowballno "github.com/kljensen/snowball/norwegian"
+	snowballru "github.com/kljensen/snowball/russian"
+	snowballes "github.com/kljensen/snowball/spanish"
+	snowballsv "github.com/kljensen/snowball/swedish"
+)
+
+// Language is an ISO 639-1 language code, such as "en" or "fr".
+type Language string
+
+// Languages with a dedicated analyzer
+const (
+	English   Language = "en"
+	French    Language = "fr"
+	German    Language = "de"
+	Hungarian Language = "hu"
+	Norwegian Language = "no"
+	Russian   Language = "ru"
+	Spanish   Language = "es"
+	Swedish   Language = "sv"
+)
+
+// ErrUnsupportedLanguage is returned for languages without a dedicated analyzer.
+var ErrUnsupportedLanguage = errors.New("unsupported language")
+
+// languageSupport holds the language-specific parts of an analyzer.
+type languageSupport struct {
+	name       string
+	stem       func(word string, stemStopWords bool) string
+	isStopword func(word string) bool
+}
+
+var languages = map[Language]languageSupport{
+	English:   {name: "english", stem: snowballeng.Stem, isStopword: isEnglishStopword},
+	French:    {name: "french", stem: snowballfr.Stem, isStopword: snowballfr.IsStopWord},
+	German:    {name: "german", stem: noStem, isStopword: isGermanStopword},
+	Hungarian: {name: "hungarian", stem: snowballhu.Stem, isStopword: snowballhu.IsStopWord},
+	Norwegian: {name: "norwegian", stem: snowballno.Stem, isStopword: snowballno.IsStopWord},
+	Russian:   {name: "russian", stem: snowballru.Stem, isStopword: snowballru.IsStopWord},
+	Spanish:   {name: "spanish", stem: snowballes.Stem, isStopword: snowballes.IsStopWord},
+	Swedish:   {name: "swedish", stem: snowballsv.Stem, isStopword: snowballsv.IsStopWord},
+}
+
+// noStem leaves words unchanged, for languages without a Snowball stemmer.
+func noStem(word string, _ bool) string {
+	return word
+}
+
+// germanStopwords are the most common German words. The Snowball package has
+// no German stemmer, so German text is only lower-cased and stripped of these.
+var germanStopwords = map[string]bool{
+	"aber": true, "alle": true, "als": true, "also": true, "am": true, "an": true,
+	"auch": true, "auf": true, "aus": true, "bei": true, "bin": true, "bis": true,
+	"da": true, "damit": true, "dann": true, "das": true, "dass": true, "dem": true,
+	"den": true, "der": true, "des": true, "die": true, "dies": true, "diese": true,
+	"dieser": true, "doch": true, "du": true, "durch": true, "ein": true, "eine": true,
+	"einem": true, "einen": true, "einer": true, "eines": true, "er": true, "es": true,
+	"für": true, "hat": true, "hatte": true, "ich": true, "ihr": true, "im": true,
+	"in": true, "ist": true, "ja": true, "kann": true, "man": true, "mit": true,
+	"nach": true, "nicht": true, "noch": true, "nur": true, "ob": true, "oder": true,
+	"sein": true, "seine": true, "sich": true, "sie": true, "sind": true, "so": true,
+	"über": true, "um": true, "und": true, "uns": true, "unter": true, "vom": true,
+	"von": true, "vor": true, "war": true, "waren": true, "was": true, "wenn": true,
+	"wie": true, "wir": true, "wird": true, "wo": true, "wurde": true, "zu": true,
+	"zum": true, "zur": true,
+}
+
+// isGermanStopword reports whether word is a German stop word.
+func isGermanStopword(word string) bool {
+	return germanStopwords[word]
+}
+
+// Languages returns the languages with a dedicated analyzer, sorted by code.
+func Languages() []Language {
+	r := make([]Language, 0, len(languages))
+	for lang := range languages {
+		r = append(r, lang)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i] < r[j] })
+	return r
+}
+
+// ParseLanguage parses a language code ("fr") or English language name ("french").
+func ParseLanguage(s string) (Language, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for lang, support := range languages {
+		if s == string(lang) || s == support.name {
+			return lang, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnsupportedLanguage, s)
+}
+
+// String returns the English name of the language, or its code if unsupported.
+func (lang Language) String() string {
+	if support, ok := languages[lang]; ok {
+		return support.name
+	}
+	return string(lang)
+}
+
+// NewStemmerFilter returns a filter reducing words to their stem using the
+// Snowball stemmer for lang. The filter leaves German words unchanged.
+func NewStemmerFilter(lang Language) (TokenFilter, error) {
+	support, ok := languages[lang]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedLanguage, lang)
+	}
+	return NamedFilter(support.name+" stemmer", NewTermFilter(func(term string) string {
+		return support.stem(term, false)
+	})), nil
+}
+
+// LanguageStopwords returns the stop words of lang.
+func LanguageStopwords(lang Language) (StopwordSet, error) {
+	support, ok := languages[lang]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedLanguage, lang)
+	}
+	return stopwordFunc(support.isStopword), nil
+}
+
+// NewLanguageStopwordFilter returns a filter removing the stop words of lang.
+func NewLanguageStopwordFilter(lang Language) (TokenFilter, error) {
+	stopwords, err := LanguageStopwords(lang)
+	if err != nil {
+		return nil, err
+	}
+	return NewStopwordFilter(stopwords), nil
+}
+
+// NewLanguageAnalyzer returns an analyzer like NewEnglishAnalyzer, using the
+// stop words and stemmer of lang. Additional filters, such as ASCIIFoldingFilter,
+// normalize tokens before they are lower-cased, stop words removed and stemmed.
+// Stop words are also removed before these filters, as some only match unfolded,
+// like the French "été", and others only once folded, like "ＴＨＥ".
+func NewLanguageAnalyzer(lang Language, filters ...TokenFilter) (*ChainAnalyzer, error) {
+	stopwords, err := LanguageStopwords(lang)
+	if err != nil {
+		return nil, err
+	}
+	return NewLanguageAnalyzerWithStopwords(lang, stopwords, filters...)
+}
+
+// NewLanguageAnalyzerWithStopwords is like NewLanguageAnalyzer, removing the given
+// stop words instead of those of lang. A nil set keeps every word, see WithKeptStopwords.
+func NewLanguageAnalyzerWithStopwords(lang Language, stopwords StopwordSet, filters ...TokenFilter) (*ChainAnalyzer, error) {
+	stemmer, err := NewStemmerFilter(lang)
+	if err != nil {
+		return nil, err
+	}
+	b := NewAnalyzerBuilder(StandardTokenizer).Filter(CharacterFilter)
+	if len(filters) > 0 {
+		if stopwords != nil {
+			b.Filter(lowercaseStopwordFilter(stopwords))
+		}
+		b.Filter(filters...)
+	}
+	b.Filter(LowercaseFilter)
+	if stopwords != nil {
+		b.Filter(NewStopwordFilter(stopwords))
+	}
+	return b.TermFilter(stemmer).Build(), nil
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLanguage(t *testing.T) {
+	lang, err := ParseLanguage("fr")
+	assert.NoError(t, err)
+	assert.Equal(t, French, lang)
+
+	lang, err = ParseLanguage(" Swedish ")
+	assert.NoError(t, err)
+	assert.Equal(t, Swedish, lang)
+	assert.Equal(t, "swedish", lang.String())
+
+	_, err = ParseLanguage("klingon")
+	assert.ErrorIs(t, err, ErrUnsupportedLanguage)
+
+	assert.Equal(t, []Language{German, English, Spanish, French, Hungarian, Norwegian, Russian, Swedish}, Languages())
+}
+
+func TestLanguageAnalyzer(t *testing.T) {
+	testCases := []struct {
+		lang   Language
+		text   string
+		tokens []string
+	}{
+		{
+			lang:   English,
+			text:   "The cats are running",
+			tokens: []string{"cat", "run"},
+		},
+		{
+			lang:   French,
+			text:   "Les chats sont dans la maison",
+			tokens: []string{"le", "chat", "maison"},
+		},
+		{
+			lang:   Spanish,
+			text:   "Los gatos corren por la casa",
+			tokens: []string{"gat", "corr", "cas"},
+		},
+		{
+			lang:   Russian,
+			text:   "Кошки бегают по дому",
+			tokens: []string{"кошк", "бега", "дом"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.lang.String(), func(t *testing.T) {
+			a, err := NewLanguageAnalyzer(tc.lang)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.tokens, a.Analyze(tc.text))
+		})
+	}
+
+	_, err := NewLanguageAnalyzer("xx")
+	assert.ErrorIs(t, err, ErrUnsupportedLanguage)
+}
+
+func TestFieldAnalyzer(t *testing.T) {
+	french, err := NewLanguageAnalyzer(French)
+	assert.NoError(t, err)
+	docs := []*Document{
+		{ID: 1, Title: "Les chanteurs", Text: "Singers perform songs"},
+		{ID: 2, Title: "La chanson", Text: "A song is a musical composition"},
+	}
+
+	for _, idx := range []Indexer{NewIndex(WithField(FieldTitle, french)), NewConcurrentIndex(WithField(FieldTitle, french))} {
+		idx.Add(docs)
+
+		// The text field is analyzed in English, the title field in French
+		assert.Len(t, idx.Search("singing"), 0)
+		assert.Len(t, idx.Search("song"), 2)
+		results := idx.Search("title:chanteur")
+		assert.Len(t, results, 1)
+		assert.Equal(t, 1, results[0].DocID)
+		assert.Len(t, idx.Search("title:chan*"), 2)
+		assert.Empty(t, idx.Search("title:song"))
+
+		// Unknown fields are searched as plain text
+		assert.Len(t, idx.Search("http://song"), 2)
+	}
+
+	// Indexes report the analyzers of their fields and detected languages
+	for name, idx := range map[string]Indexer{
+		"Index":           NewIndex(WithField(FieldTitle, french), WithLanguageDetection(nil)),
+		"ConcurrentIndex": NewConcurrentIndex(WithField(FieldTitle, french), WithLanguageDetection(nil)),
+		"ShardedIndex":    NewShardedIndex(2, WithField(FieldTitle, french)),
+	} {
+		lookup, ok := idx.(AnalyzerLookup)
+		assert.True(t, ok, name)
+		a, ok := lookup.FieldAnalyzer(FieldTitle)
+		assert.True(t, ok, name)
+		assert.Same(t, french, a, name)
+		a, ok = lookup.FieldAnalyzer(FieldText)
+		assert.True(t, ok, name)
+		assert.Same(t, idx.Analyzer(), a, name)
+		_, ok = lookup.FieldAnalyzer("body")
+		assert.False(t, ok, name)
+		_, ok = lookup.LanguageAnalyzer(French)
+		assert.Equal(t, name != "ShardedIndex", ok, name)
+	}
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// ErrDocumentNotFound is returned when a document ID is not in the index.
+var ErrDocumentNotFound = errors.New("document not found")
+
+// MoreLikeThisOptions configures how MoreLikeThis selects the terms of its query.
+// Zero values select the defaults.
+type MoreLikeThisOptions struct {
+	MaxQueryTerms int // Maximum number of terms in the query (default 25)
+	MinTermFreq   int // Minimum occurrences of a term in the source text (default 1)
+	MinDocFreq    int // Minimum number of documents containing a term (default 2)
+	MaxDocFreq    int // Maximum number of documents containing a term (default unlimited)
+}
+
+// withDefaults returns the options with zero values replaced by defaults.
+func (opts MoreLikeThisOptions) withDefaults() MoreLikeThisOptions {
+	if opts.MaxQueryTerms <= 0 {
+		opts.MaxQueryTerms = 25
+	}
+	if opts.MinTermFreq <= 0 {
+		opts.MinTermFreq = 1
+	}
+	if opts.MinDocFreq <= 0 {
+		// A term found in a single document can only match the source itself
+		opts.MinDocFreq = 2
+	}
+	return opts
+}
+
+// moreLikeThis finds documents similar to text, leaving out the document excludeID.
+//
+// The most distinctive terms of text are selected by TF-IDF and combined into a
+// query where each term is weighted by its TF-IDF relative to the best term.
+func moreLikeThis(src termSource, text string, excludeID int, opts MoreLikeThisOptions) []SearchResult {
+	opts = opts.withDefaults()
+
+	tokens := src.Analyzer().Analyze(text)
+	tokenFreq := make(map[string]int)
+	for _, token := range tokens {
+		tokenFreq[token]++
+	}
+
+	docCount := src.numDocs()
+	var terms []weightedTerm
+	for token, freq := range tokenFreq {
+		if freq < opts.MinTermFreq {
+			continue
+		}
+		// Replaced documents are left out, as when scoring
+		df := src.docFreq(token)
+		if df < opts.MinDocFreq || (opts.MaxDocFreq > 0 && df > opts.MaxDocFreq) {
+			continue
+		}
+		tf := float32(freq) / float32(len(tokens))
+		terms = append(terms, weightedTerm{term: token, weight: tf * inverseDocFreq(docCount, df)})
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+
+	// Keep the most distinctive terms, boosted relative to the best one
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].weight != terms[j].weight {
+			return terms[i].weight > terms[j].weight
+		}
+		return terms[i].term < terms[j].term
+	})
+	terms = terms[:min(len(terms), opts.MaxQueryTerms)]
+	groups := make([][]weightedTerm, len(terms))
+	for i, wt := range terms {
+		groups[i] = []weightedTerm{{term: wt.term, weight: wt.weight / terms[0].weight}}
+	}
+
+	results, _ := scoreGroups(context.Background(), src, groups, 0)
+	for i, result := range results {
+		if result.DocID == excludeID {
+			return append(results[:i], results[i+1:]...)
+		}
+	}
+	return results
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoreLikeThis(t *testing.T) {
+	docs := []*Document{
+		{ID: 0, Text: "Jupiter is the largest planet in the Solar System, a gas giant."},
+		{ID: 1, Text: "Saturn is a gas giant planet known for its rings."},
+		{ID: 2, Text: "Neptune is an ice giant planet far from the Sun."},
+		{ID: 3, Text: "The violin is a string instrument played with a bow."},
+		{ID: 4, Text: "The cello is a bowed string instrument."},
+	}
+
+	for _, idx := range []Indexer{NewIndex(), NewConcurrentIndex()} {
+		idx.Add(docs)
+
+		// Similar documents exclude the source
+		results, err := idx.MoreLikeThis(1, MoreLikeThisOptions{})
+		assert.NoError(t, err)
+		assert.Len(t, results, 2)
+		assert.Equal(t, 0, results[0].DocID, "Jupiter shares both 'gas' and 'giant' with Saturn")
+		assert.Equal(t, 2, results[1].DocID)
+
+		// Terms found in too many documents are ignored
+		results, err = idx.MoreLikeThis(1, MoreLikeThisOptions{MaxDocFreq: 2})
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, 0, results[0].DocID)
+
+		_, err = idx.MoreLikeThis(42, MoreLikeThisOptions{})
+		assert.ErrorIs(t, err, ErrDocumentNotFound)
+
+		// Arbitrary text works too, without excluding anything
+		results = idx.MoreLikeThisText("an orchestra string instrument", MoreLikeThisOptions{})
+		assert.Len(t, results, 2)
+		assert.ElementsMatch(t, []int{3, 4}, []int{results[0].DocID, results[1].DocID})
+	}
+}
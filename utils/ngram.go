@@ -0,0 +1,91 @@
+package utils
+
+import "fmt"
+
+// NewEdgeNGramFilter returns a filter replacing tokens with their prefixes of minSize
+// to maxSize characters, stacked at the position of the token, for search-as-you-type.
+// Tokens shorter than minSize are kept whole.
+func NewEdgeNGramFilter(minSize, maxSize int) TokenFilter {
+	return NamedFilter(fmt.Sprintf("edge n-grams %d-%d", minSize, maxSize), TokenFilterFunc(func(tokens []Token) []Token {
+		r := make([]Token, 0, len(tokens))
+		for _, token := range tokens {
+			chars := charOffsets(token.Term)
+			if len(chars)-1 < minSize {
+				r = append(r, token)
+				continue
+			}
+			for size := minSize; size <= min(maxSize, len(chars)-1); size++ {
+				gram := token
+				gram.Term = token.Term[:chars[size]]
+				if size > minSize {
+					gram.PositionIncrement = 0
+				}
+				r = append(r, gram)
+			}
+		}
+		return r
+	}))
+}
+
+// NewNGramFilter returns a filter replacing tokens with their substrings of minSize
+// to maxSize characters, for substring matching. The n-grams starting at the same
+// character are stacked, and each following character takes the next position, so
+// that a word analyzed the same way in a query matches as a phrase of its n-grams,
+// that is as a substring. Tokens shorter than minSize are kept whole.
+func NewNGramFilter(minSize, maxSize int) TokenFilter {
+	return NamedFilter(fmt.Sprintf("n-grams %d-%d", minSize, maxSize), TokenFilterFunc(func(tokens []Token) []Token {
+		r := make([]Token, 0, len(tokens))
+		shift := 0 // positions taken by the n-grams of previous tokens
+		for _, token := range tokens {
+			token.Position += shift
+			chars := charOffsets(token.Term)
+			n := len(chars) - 1
+			if n < minSize {
+				r = append(r, token)
+				continue
+			}
+			for start := 0; start+minSize <= n; start++ {
+				for size := minSize; size <= maxSize && start+size <= n; size++ {
+					gram := token
+					gram.Term = token.Term[chars[start]:chars[start+size]]
+					gram.Position = token.Position + start
+					r = append(r, gram)
+				}
+			}
+			shift += n - minSize
+		}
+		setIncrements(r)
+		return r
+	}))
+}
+
+// charOffsets returns the byte offsets of the characters of s, followed by len(s).
+func charOffsets(s string) []int {
+	offsets := make([]int, 0, len(s)+1)
+	for i := range s {
+		offsets = append(offsets, i)
+	}
+	return append(offsets, len(s))
+}
+
+// NewEdgeNGramAnalyzer returns an analyzer for search-as-you-type fields: words are
+// lower-cased and indexed as their prefixes of minSize to maxSize characters, so
+// that "einst" matches "Einstein". Queries on such fields should be analyzed without
+// n-grams, see WithAnalyzedField.
+func NewEdgeNGramAnalyzer(minSize, maxSize int) *ChainAnalyzer {
+	return NewAnalyzerBuilder(StandardTokenizer).
+		Filter(CharacterFilter, LowercaseFilter).
+		TermFilter(NewEdgeNGramFilter(minSize, maxSize)).
+		Build()
+}
+
+// NewNGramAnalyzer returns an analyzer for substring matching on identifiers: tokens
+// of the EntityTokenizer are lower-cased and indexed as their substrings of minSize
+// to maxSize characters. Used for queries as well, it matches documents containing
+// each query word as a substring, see NewNGramFilter.
+func NewNGramAnalyzer(minSize, maxSize int) *ChainAnalyzer {
+	return NewAnalyzerBuilder(EntityTokenizer).
+		Filter(LowercaseFilter).
+		TermFilter(NewNGramFilter(minSize, maxSize)).
+		Build()
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEdgeNGramFilter(t *testing.T) {
+	tokens := NewEdgeNGramFilter(2, 4).Filter([]Token{
+		{Term: "café", Start: 0, End: 5, Position: 0, PositionIncrement: 1},
+		{Term: "a", Start: 6, End: 7, Position: 1, PositionIncrement: 1},
+		{Term: "olé", Start: 8, End: 12, Position: 3, PositionIncrement: 2},
+	})
+	assert.Equal(t, []Token{
+		{Term: "ca", Start: 0, End: 5, Position: 0, PositionIncrement: 1},
+		{Term: "caf", Start: 0, End: 5, Position: 0, PositionIncrement: 0},
+		{Term: "café", Start: 0, End: 5, Position: 0, PositionIncrement: 0},
+		{Term: "a", Start: 6, End: 7, Position: 1, PositionIncrement: 1},
+		{Term: "ol", Start: 8, End: 12, Position: 3, PositionIncrement: 2},
+		{Term: "olé", Start: 8, End: 12, Position: 3, PositionIncrement: 0},
+	}, tokens)
+}
+
+func TestNGramFilter(t *testing.T) {
+	tokens := NewNGramFilter(2, 3).Filter(newTokens([]string{"abcd", "x", "yz"}))
+	assert.Equal(t, []string{"ab", "abc", "bc", "bcd", "cd", "x", "yz"}, tokenTerms(tokens))
+	var positions, increments []int
+	for _, token := range tokens {
+		positions, increments = append(positions, token.Position), append(increments, token.PositionIncrement)
+	}
+	assert.Equal(t, []int{0, 0, 1, 1, 2, 3, 4}, positions)
+	assert.Equal(t, []int{1, 0, 1, 0, 1, 1, 1}, increments)
+}
+
+func TestNGramFields(t *testing.T) {
+	docs := []*Document{
+		{ID: 1, Title: "Albert Einstein", Text: "Theoretical physicist", URL: "https://example.org/getUserName"},
+		{ID: 2, Title: "Einsteinium", Text: "A synthetic element", URL: "https://example.org/setUserId"},
+		{ID: 3, Title: "Albania", Text: "A country in Europe", URL: "https://example.org/parseConfig"},
+	}
+	titles := NewAnalyzerBuilder(StandardTokenizer).Filter(CharacterFilter, LowercaseFilter).Build()
+	opts := []IndexOption{
+		WithAnalyzedField("title_prefix", FieldTitle, NewEdgeNGramAnalyzer(2, 15), titles),
+		WithField(FieldURL, NewNGramAnalyzer(3, 3)),
+	}
+
+	for _, idx := range []Indexer{NewIndex(opts...), NewConcurrentIndex(opts...)} {
+		idx.Add(docs)
+
+		// Prefixes of title words match, with the text field unchanged
+		assert.ElementsMatch(t, []int{1, 2}, docIDs(idx.Search("title_prefix:eins")))
+		assert.ElementsMatch(t, []int{1, 3}, docIDs(idx.Search("title_prefix:alb")))
+		assert.Equal(t, []int{1}, docIDs(idx.Search(`title_prefix:"alb einst"`)))
+		assert.Empty(t, idx.Search("title_prefix:stein"))
+		assert.Empty(t, idx.Search("eins"))
+
+		// Words match URLs containing them
+		assert.Equal(t, []int{1}, docIDs(idx.Search("url:username")))
+		assert.ElementsMatch(t, []int{1, 2}, docIDs(idx.Search("url:user")))
+		assert.Equal(t, []int{3}, docIDs(idx.Search("url:config")))
+		assert.Empty(t, idx.Search("url:userconfig"))
+	}
+}
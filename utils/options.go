@@ -0,0 +1,267 @@
+package utils
+
+// DefaultMaxExpansions is the default maximum number of dictionary terms a
+// single prefix, wildcard, range or fuzzy query term may expand to.
+const DefaultMaxExpansions = 1024
+
+// IndexOption configures an index created by NewIndex or NewConcurrentIndex.
+type IndexOption func(*indexConfig)
+
+// indexConfig holds the settings shared by all index implementations.
+type indexConfig struct {
+	analyzer      Analyzer
+	maxExpansions int
+	searchWorkers int // goroutines scoring a query in a ConcurrentIndex, see WithSearchWorkers
+	memoryBudget  int64
+	spillDir      string
+	fields        []fieldConfig
+	filter        bool     // whether the index is a filter field, see fieldConfig
+	source        string   // document field indexed, if not the name of the field
+	queryAnalyzer Analyzer // analyzer for queries, if not analyzer
+	synonyms      *SynonymMap
+	synonymMode   SynonymMode
+	keptStopwords StopwordSet // stop words indexed but ignored by queries, see WithKeptStopwords
+	commonGrams   StopwordSet
+
+	// Language detection, see WithLanguageDetection
+	detector      *LanguageDetector
+	detectQuery   bool
+	langAnalyzers map[Language]Analyzer
+}
+
+// fieldConfig describes an additional document field to index.
+// Query clauses on a filter field restrict results instead of being scored.
+type fieldConfig struct {
+	name          string
+	source        string // document field indexed, if not name
+	analyzer      Analyzer
+	queryAnalyzer Analyzer // analyzer for queries, if not analyzer
+	filter        bool
+}
+
+// newIndexConfig returns the default configuration with opts applied.
+func newIndexConfig(opts []IndexOption) indexConfig {
+	cfg := indexConfig{
+		analyzer:      defaultAnalyzer,
+		maxExpansions: DefaultMaxExpansions,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithAnalyzer sets the analyzer used for indexed documents and queries.
+// The default is NewEnglishAnalyzer.
+func WithAnalyzer(a Analyzer) IndexOption {
+	return func(cfg *indexConfig) {
+		cfg.analyzer = a
+	}
+}
+
+// WithField indexes an additional document field, such as FieldTitle, using its own
+// analyzer. Its terms are searched with the "name:term" query syntax. The Text field
+// is always indexed, with the analyzer set by WithAnalyzer.
+func WithField(name string, a Analyzer) IndexOption {
+	return func(cfg *indexConfig) {
+		cfg.addField(fieldConfig{name: name, analyzer: a})
+	}
+}
+
+// WithAnalyzedField indexes the document field source as the field name, analyzed
+// with index, and analyzes queries on the field with search. This lets one document
+// field be indexed in several ways, e.g. for search-as-you-type on titles:
+//
+//	WithAnalyzedField("title_prefix", FieldTitle, NewEdgeNGramAnalyzer(2, 15), titleAnalyzer)
+//
+// A nil search analyzer analyzes queries with index.
+func WithAnalyzedField(name, source string, index, search Analyzer) IndexOption {
+	return func(cfg *indexConfig) {
+		cfg.addField(fieldConfig{name: name, source: source, analyzer: index, queryAnalyzer: search})
+	}
+}
+
+// addField adds or replaces the configuration of an additional field.
+func (cfg *indexConfig) addField(field fieldConfig) {
+	for i := range cfg.fields {
+		if cfg.fields[i].name == field.name {
+			cfg.fields[i] = field
+			return
+		}
+	}
+	cfg.fields = append(cfg.fields, field)
+}
+
+// fieldConfig returns the configuration of an index for one of its fields.
+func (cfg indexConfig) fieldConfig(field fieldConfig) indexConfig {
+	fieldCfg := indexConfig{
+		analyzer:      field.analyzer,
+		maxExpansions: cfg.maxExpansions,
+		memoryBudget:  cfg.memoryBudget,
+		spillDir:      cfg.spillDir,
+		filter:        field.filter,
+		source:        field.source,
+		queryAnalyzer: field.queryAnalyzer,
+	}
+	if !field.filter {
+		fieldCfg.synonyms, fieldCfg.synonymMode = cfg.synonyms, cfg.synonymMode
+		fieldCfg.keptStopwords, fieldCfg.commonGrams = cfg.keptStopwords, cfg.commonGrams
+	}
+	return fieldCfg
+}
+
+// documentField returns the name of the document field indexed by an index of the field name.
+func (cfg *indexConfig) documentField(name string) string {
+	if cfg.source != "" {
+		return cfg.source
+	}
+	return name
+}
+
+// searchAnalyzer returns the analyzer for queries.
+func (cfg *indexConfig) searchAnalyzer() Analyzer {
+	if cfg.queryAnalyzer != nil {
+		return cfg.queryAnalyzer
+	}
+	return cfg.analyzer
+}
+
+// WithSynonyms expands words with their synonyms from m, either in queries or in
+// indexed documents depending on mode. Synonyms of a word compete with it rather
+// than add up, so documents matching both score no higher than either.
+func WithSynonyms(m *SynonymMap, mode SynonymMode) IndexOption {
+	return func(cfg *indexConfig) {
+		cfg.synonyms, cfg.synonymMode = m, mode
+	}
+}
+
+// WithKeptStopwords indexes stop words like any other word, so that phrases such
+// as "the who" can be searched, but ignores them in the other query clauses unless
+// the query is only made of stop words. The analyzer must not remove stopwords,
+// see NewLanguageAnalyzerWithStopwords.
+func WithKeptStopwords(stopwords StopwordSet) IndexOption {
+	return func(cfg *indexConfig) {
+		cfg.keptStopwords = stopwords
+	}
+}
+
+// WithCommonGrams also indexes every pair of adjacent words of which at least
+// one is in common, usually the stop words. Phrases containing common words are
+// then matched with these pairs, which are much rarer than the common words alone.
+// It is meant to be used with WithKeptStopwords.
+func WithCommonGrams(common StopwordSet) IndexOption {
+	return func(cfg *indexConfig) {
+		cfg.commonGrams = common
+	}
+}
+
+// querySynonyms returns the synonyms to expand queries with, or nil.
+func (cfg *indexConfig) querySynonyms() *SynonymMap {
+	if cfg.synonymMode != SynonymsAtQuery {
+		return nil
+	}
+	return cfg.synonyms
+}
+
+// WithLanguageDetection detects the language of documents indexed without one
+// and analyzes each document with the analyzer of its language. Documents in
+// languages without a dedicated analyzer use the index analyzer. The language is
+// stored in the filterable lang field, so "lang:fr" restricts results to French.
+// A nil detector uses DefaultLanguageDetector. Language analyzers are created
+// with NewLanguageAnalyzer, passing it filters.
+//
+// Queries are analyzed with the analyzers of every language in the index,
+// see WithQueryLanguageDetection to analyze them in their own language instead.
+func WithLanguageDetection(detector *LanguageDetector, filters ...TokenFilter) IndexOption {
+	stopwords := func(lang Language) StopwordSet {
+		stopwords, _ := LanguageStopwords(lang)
+		return stopwords
+	}
+	return WithLanguageDetectionStopwords(detector, stopwords, filters...)
+}
+
+// WithLanguageDetectionStopwords is like WithLanguageDetection, the analyzer of
+// each language removing stopwords(lang) instead of the stop words of lang. A nil
+// set keeps every word, as needed by WithKeptStopwords.
+func WithLanguageDetectionStopwords(detector *LanguageDetector, stopwords func(lang Language) StopwordSet, filters ...TokenFilter) IndexOption {
+	return func(cfg *indexConfig) {
+		if detector == nil {
+			detector = DefaultLanguageDetector()
+		}
+		cfg.detector = detector
+		cfg.langAnalyzers = make(map[Language]Analyzer)
+		for _, lang := range Languages() {
+			cfg.langAnalyzers[lang], _ = NewLanguageAnalyzerWithStopwords(lang, stopwords(lang), filters...)
+		}
+		cfg.addField(fieldConfig{name: FieldLang, analyzer: KeywordAnalyzer, filter: true})
+	}
+}
+
+// WithQueryLanguageDetection analyzes queries with the analyzer of their detected
+// language only. Queries too short to be recognized use every language in the index.
+// It requires WithLanguageDetection.
+func WithQueryLanguageDetection() IndexOption {
+	return func(cfg *indexConfig) {
+		cfg.detectQuery = true
+	}
+}
+
+// fieldAnalyzer returns the analyzer for queries on the field name, if it is indexed.
+func (cfg *indexConfig) fieldAnalyzer(name string) (Analyzer, bool) {
+	if name == "" || name == FieldText {
+		return cfg.searchAnalyzer(), true
+	}
+	for _, field := range cfg.fields {
+		if field.name == name && field.queryAnalyzer != nil {
+			return field.queryAnalyzer, true
+		}
+		if field.name == name {
+			return field.analyzer, true
+		}
+	}
+	return nil, false
+}
+
+// languageAnalyzer returns the analyzer for documents and queries in lang, if
+// the index detects languages and supports lang.
+func (cfg *indexConfig) languageAnalyzer(lang Language) (Analyzer, bool) {
+	a, ok := cfg.langAnalyzers[lang]
+	return a, ok
+}
+
+// analyzerFor returns the analyzer for text in lang.
+func (cfg *indexConfig) analyzerFor(lang Language) Analyzer {
+	if a, ok := cfg.langAnalyzers[lang]; ok {
+		return a
+	}
+	return cfg.analyzer
+}
+
+// WithSearchWorkers sets the number of goroutines a ConcurrentIndex scores large
+// queries with, each scoring its own share of the documents. The default is the
+// number of CPUs. An Index always scores queries with a single goroutine.
+func WithSearchWorkers(n int) IndexOption {
+	return func(cfg *indexConfig) {
+		cfg.searchWorkers = n
+	}
+}
+
+// WithMemoryBudget bounds the memory held by the postings of each field of an Index
+// to about budget bytes while adding documents. Beyond it, the postings are sorted by
+// term and spilled to a run file in dir, the system temporary directory if empty.
+// At the end of Add, the runs are merged into a postings file searched from disk,
+// only the term dictionary staying in memory. Close removes the files.
+// A ConcurrentIndex keeps its postings in memory.
+func WithMemoryBudget(budget int64, dir string) IndexOption {
+	return func(cfg *indexConfig) {
+		cfg.memoryBudget, cfg.spillDir = budget, dir
+	}
+}
+
+// WithMaxExpansions sets the maximum number of dictionary terms a single query
+// term may expand to. Queries expanding to more terms fail with ErrTooManyExpansions.
+func WithMaxExpansions(n int) IndexOption {
+	return func(cfg *indexConfig) {
+		cfg.maxExpansions = n
+	}
+}
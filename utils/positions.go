@@ -0,0 +1,85 @@
+package utils
+
+import "encoding/binary"
+
+// PositionList holds the positions of a term in each document of a posting list.
+// The positions of a document are delta encoded as uvarints, and those of all
+// documents packed in a single buffer, so that a posting costs a few bytes
+// rather than a slice of ints.
+type PositionList struct {
+	data []byte   // encoded positions of every document, in posting order
+	ends []uint32 // end offset in data of the positions of each document
+}
+
+// Len returns the number of documents with positions in the list.
+func (p PositionList) Len() int {
+	return len(p.ends)
+}
+
+// bytes returns the encoded positions of the i-th document.
+func (p PositionList) bytes(i int) []byte {
+	start := uint32(0)
+	if i > 0 {
+		start = p.ends[i-1]
+	}
+	return p.data[start:p.ends[i]]
+}
+
+// At returns the positions of the i-th document, in increasing order.
+func (p PositionList) At(i int) []int {
+	data := p.bytes(i)
+	positions := make([]int, 0, p.Count(i))
+	prev := 0
+	for len(data) > 0 {
+		delta, n := binary.Uvarint(data)
+		prev += int(delta)
+		positions = append(positions, prev)
+		data = data[n:]
+	}
+	return positions
+}
+
+// Count returns the number of positions of the i-th document, the frequency of
+// the term in it, without decoding them.
+func (p PositionList) Count(i int) int {
+	count := 0
+	for _, b := range p.bytes(i) {
+		if b < 0x80 {
+			count++ // last byte of a uvarint
+		}
+	}
+	return count
+}
+
+// add appends the positions of the next document, in increasing order, and
+// returns the number of bytes they take.
+func (p *PositionList) add(positions []int) int {
+	n := len(p.data)
+	prev := 0
+	for _, pos := range positions {
+		p.data = binary.AppendUvarint(p.data, uint64(pos-prev))
+		prev = pos
+	}
+	p.ends = append(p.ends, uint32(len(p.data)))
+	return len(p.data) - n
+}
+
+// addEncoded appends the positions of the next document, as encoded by add.
+func (p *PositionList) addEncoded(data []byte) {
+	p.data = append(p.data, data...)
+	p.ends = append(p.ends, uint32(len(p.data)))
+}
+
+// appendPositions returns the positions of dst followed by those of src, never
+// writing to the arrays of dst.
+func appendPositions(dst, src PositionList) PositionList {
+	base := uint32(len(dst.data))
+	ends := append(dst.ends[:len(dst.ends):len(dst.ends)], src.ends...)
+	for i := len(dst.ends); i < len(ends); i++ {
+		ends[i] += base
+	}
+	return PositionList{
+		data: append(dst.data[:len(dst.data):len(dst.data)], src.data...),
+		ends: ends,
+	}
+}
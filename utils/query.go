@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFuzzyDistance is the largest edit distance accepted in fuzzy query terms.
+const maxFuzzyDistance = 2
+
+// clauseKind identifies how a query clause matches index terms.
+type clauseKind int
+
+const (
+	textClause     clauseKind = iota // analyzed text, one scoring clause per token
+	fuzzyClause                      // term~N, matches terms within N edits
+	prefixClause                     // term*, matches terms starting with term
+	wildcardClause                   // te?t or t*t, matches terms against a pattern
+	rangeClause                      // [lower TO upper], matches terms sorting between the bounds
+	phraseClause                     // "quoted text", matches its terms at consecutive positions
+)
+
+// queryClause is a single whitespace-separated part of a query.
+type queryClause struct {
+	kind     clauseKind
+	field    string // document field searched, empty for the default field
+	text     string
+	distance int // maximum edit distance of fuzzy clauses
+
+	// Bounds of range clauses, an empty bound is open
+	lower, upper               string
+	includeLower, includeUpper bool
+}
+
+// parseQuery splits text into clauses. The supported syntax is:
+//
+//	term~N          fuzzy term, matching terms within N edits (N is 0 to 2, defaults to 2)
+//	term*           prefix, matching terms starting with term
+//	te?t, t*t       wildcard, '?' matches one character and '*' any number of characters
+//	[lower TO upper] range of terms, inclusive; use {} for exclusive bounds and * for an open bound
+//	"quoted text"   phrase, matching documents containing its terms next to each other
+//
+// Each of them may be prefixed with "field:" to search an additional indexed field,
+// for example title:einstein. Anything else is analyzed as plain text.
+func parseQuery(text string) []queryClause {
+	var clauses []queryClause
+	parts := splitQuery(text)
+	for i := 0; i < len(parts); i++ {
+		field, part := splitField(parts[i])
+		clause, ok := queryClause{}, false
+		if i+2 < len(parts) {
+			if clause, ok = parseRange(part, parts[i+1], parts[i+2]); ok {
+				i += 2
+			}
+		}
+		if !ok {
+			clause = parseClause(part)
+		}
+		clause.field = field
+		clauses = append(clauses, clause)
+	}
+	return clauses
+}
+
+// splitQuery splits text on whitespace, except inside double quotes.
+// A missing closing quote is implied at the end of text.
+func splitQuery(text string) []string {
+	bounds := queryParts(text)
+	parts := make([]string, len(bounds))
+	for i, b := range bounds {
+		parts[i] = text[b[0]:b[1]]
+	}
+	return parts
+}
+
+// queryParts returns the start and end offsets of the parts of text split by splitQuery.
+func queryParts(text string) [][2]int {
+	var parts [][2]int
+	start, quoted := -1, false
+	for i, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			if start >= 0 {
+				parts = append(parts, [2]int{start, i})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		parts = append(parts, [2]int{start, len(text)})
+	}
+	return parts
+}
+
+// splitField splits a "field:rest" query part. Field names are made of lower-case
+// letters and underscores; the part is returned unchanged if it has no field prefix
+// or is a URL.
+func splitField(s string) (string, string) {
+	i := strings.IndexByte(s, ':')
+	if i <= 0 || i == len(s)-1 || strings.HasPrefix(s[i+1:], "//") {
+		return "", s
+	}
+	for _, r := range s[:i] {
+		if (r < 'a' || r > 'z') && r != '_' {
+			return "", s
+		}
+	}
+	return s[:i], s[i+1:]
+}
+
+// parseRange parses a range clause spread over three whitespace-separated parts.
+func parseRange(lower, to, upper string) (queryClause, bool) {
+	if to != "TO" || len(lower) < 2 || len(upper) < 2 {
+		return queryClause{}, false
+	}
+	first, last := lower[0], upper[len(upper)-1]
+	if (first != '[' && first != '{') || (last != ']' && last != '}') {
+		return queryClause{}, false
+	}
+
+	clause := queryClause{
+		kind:         rangeClause,
+		text:         lower + " " + to + " " + upper,
+		lower:        strings.ToLower(lower[1:]),
+		upper:        strings.ToLower(upper[:len(upper)-1]),
+		includeLower: first == '[',
+		includeUpper: last == ']',
+	}
+	if clause.lower == "*" {
+		clause.lower = ""
+	}
+	if clause.upper == "*" {
+		clause.upper = ""
+	}
+	return clause, true
+}
+
+// parseClause parses a single whitespace-free part of a query.
+func parseClause(s string) queryClause {
+	if strings.HasPrefix(s, `"`) {
+		return queryClause{kind: phraseClause, text: strings.Trim(s, `"`)}
+	}
+	if i := strings.IndexAny(s, "*?"); i >= 0 {
+		pattern := strings.ToLower(s)
+		if i == len(s)-1 && s[i] == '*' {
+			return queryClause{kind: prefixClause, text: pattern[:i]}
+		}
+		return queryClause{kind: wildcardClause, text: pattern}
+	}
+	if i := strings.LastIndexByte(s, '~'); i > 0 {
+		distance, err := maxFuzzyDistance, error(nil)
+		if suffix := s[i+1:]; suffix != "" {
+			distance, err = strconv.Atoi(suffix)
+		}
+		if err == nil && distance >= 0 {
+			return queryClause{
+				kind:     fuzzyClause,
+				text:     s[:i],
+				distance: min(distance, maxFuzzyDistance),
+			}
+		}
+	}
+	return queryClause{kind: textClause, text: s}
+}
+
+// querySurface returns the surface form of a single query word, or false if the
+// word is removed by analysis (e.g. a stopword).
+func querySurface(a Analyzer, word string) (string, bool) {
+	forms := surfaceForms(a, word)
+	if len(forms) == 0 {
+		return "", false
+	}
+	return forms[0], true
+}
+
+// surfacePattern runs the words of a prefix, wildcard or range pattern through
+// the surface analysis of a, e.g. to fold accents, leaving wildcards alone.
+// Words removed by the analysis, such as stopwords or single letters, are kept as is.
+func surfacePattern(a Analyzer, pattern string) string {
+	var b strings.Builder
+	for len(pattern) > 0 {
+		end := strings.IndexFunc(pattern, func(r rune) bool { return !isWordRune(r) })
+		switch {
+		case end < 0:
+			end = len(pattern)
+		case end == 0:
+			// Copy the wildcard or punctuation rune as is
+			_, end = utf8.DecodeRuneInString(pattern)
+			b.WriteString(pattern[:end])
+			pattern = pattern[end:]
+			continue
+		}
+
+		word := pattern[:end]
+		if forms := surfaceForms(a, word); len(forms) == 1 {
+			word = forms[0]
+		}
+		b.WriteString(word)
+		pattern = pattern[end:]
+	}
+	return b.String()
+}
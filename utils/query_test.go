@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuery(t *testing.T) {
+	testCases := []struct {
+		query   string
+		clauses []queryClause
+	}{
+		{
+			query:   "",
+			clauses: nil,
+		},
+		{
+			query:   "small wild,cat",
+			clauses: []queryClause{{kind: textClause, text: "small"}, {kind: textClause, text: "wild,cat"}},
+		},
+		{
+			query:   "einstien~1 theory",
+			clauses: []queryClause{{kind: fuzzyClause, text: "einstien", distance: 1}, {kind: textClause, text: "theory"}},
+		},
+		{
+			query:   "relativty~",
+			clauses: []queryClause{{kind: fuzzyClause, text: "relativty", distance: 2}},
+		},
+		{
+			query:   "relativty~5",
+			clauses: []queryClause{{kind: fuzzyClause, text: "relativty", distance: 2}},
+		},
+		{
+			query:   "Quant* te?t t*t",
+			clauses: []queryClause{{kind: prefixClause, text: "quant"}, {kind: wildcardClause, text: "te?t"}, {kind: wildcardClause, text: "t*t"}},
+		},
+		{
+			query: "[Alpha TO beta} {* TO gamma]",
+			clauses: []queryClause{
+				{kind: rangeClause, text: "[Alpha TO beta}", lower: "alpha", upper: "beta", includeLower: true},
+				{kind: rangeClause, text: "{* TO gamma]", upper: "gamma", includeUpper: true},
+			},
+		},
+		{
+			query:   "[alpha to beta]",
+			clauses: []queryClause{{kind: textClause, text: "[alpha"}, {kind: textClause, text: "to"}, {kind: textClause, text: "beta]"}},
+		},
+		{
+			query: "title:einstein title:[a TO b] url:go* Re:x 12:30",
+			clauses: []queryClause{
+				{kind: textClause, field: "title", text: "einstein"},
+				{kind: rangeClause, field: "title", text: "[a TO b]", lower: "a", upper: "b", includeLower: true, includeUpper: true},
+				{kind: prefixClause, field: "url", text: "go"},
+				{kind: textClause, text: "Re:x"},
+				{kind: textClause, text: "12:30"},
+			},
+		},
+		{
+			query: `"United  States" title:"new york" "unterminated phrase`,
+			clauses: []queryClause{
+				{kind: phraseClause, text: "United  States"},
+				{kind: phraseClause, field: "title", text: "new york"},
+				{kind: phraseClause, text: "unterminated phrase"},
+			},
+		},
+		{
+			query:   "~1 about~x",
+			clauses: []queryClause{{kind: textClause, text: "~1"}, {kind: textClause, text: "about~x"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			assert.Equal(t, tc.clauses, parseQuery(tc.query))
+		})
+	}
+}
@@ -0,0 +1,857 @@
+package utils
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrTooManyExpansions is returned when a prefix, wildcard, range or fuzzy query
+// term matches more dictionary terms than the index allows.
+var ErrTooManyExpansions = errors.New("query term expands to too many terms")
+
+// termSource gives query evaluation read access to an index.
+type termSource interface {
+	// numDocs returns the number of documents used for IDF calculation
+	numDocs() int
+
+	// lookup returns the postings of a term
+	lookup(term string) (IndexEntry, bool)
+
+	// docFreq returns the number of documents containing a term used for IDF calculation,
+	// which is that of its postings unless the source is part of a larger index
+	docFreq(term string) int
+
+	// dictionary returns the sorted dictionary of unstemmed surface forms, built
+	// on first use unless ctx is done first
+	dictionary(ctx context.Context) (*termDict, error)
+
+	// maxExpansions returns the maximum number of terms a query term may expand to
+	maxExpansions() int
+
+	// Analyzer returns the analyzer used for queries
+	Analyzer() Analyzer
+
+	// fieldSource returns the source of an indexed document field, or nil if the
+	// field is not indexed. An empty name returns the source itself.
+	fieldSource(name string) termSource
+
+	// settings returns the configuration of the source
+	settings() *indexConfig
+
+	// searchWorkers returns the number of goroutines scoring a query
+	searchWorkers() int
+
+	// live reports whether a document has not been replaced by a later one with the
+	// same key. Replaced documents keep their postings but are never returned.
+	live(docID int) bool
+}
+
+// weightedTerm is an index term or phrase matched by a query clause, with the
+// weight applied to its score.
+type weightedTerm struct {
+	field  string
+	term   string
+	phrase []string // terms at consecutive positions, matched instead of term if set
+	offset []int    // position of each phrase term relative to the first one, if not consecutive
+	weight float32
+}
+
+// newWeightedTerm returns a weightedTerm matching terms, as a phrase if there are several.
+func newWeightedTerm(terms []string, weight float32) weightedTerm {
+	if len(terms) == 1 {
+		return weightedTerm{term: terms[0], weight: weight}
+	}
+	return weightedTerm{phrase: terms, weight: weight}
+}
+
+// newPhraseTerm returns a weightedTerm matching the terms of tokens at their
+// relative positions, as a phrase if there are several.
+func newPhraseTerm(tokens []Token, weight float32) weightedTerm {
+	wt := newWeightedTerm(tokenTerms(tokens), weight)
+	for i, token := range tokens {
+		if token.Position-tokens[0].Position != i {
+			wt.offset = make([]int, len(tokens))
+			for j, token := range tokens {
+				wt.offset[j] = token.Position - tokens[0].Position
+			}
+			break
+		}
+	}
+	return wt
+}
+
+// key identifies the term or phrase matched by wt.
+func (wt weightedTerm) key() string {
+	if wt.offset != nil {
+		return fmt.Sprint(wt.phrase, wt.offset)
+	}
+	if wt.phrase != nil {
+		return strings.Join(wt.phrase, " ")
+	}
+	return wt.term
+}
+
+// expandedQuery is a parsed query turned into index terms.
+type expandedQuery struct {
+	groups  [][]weightedTerm    // scored clauses, see expandClauses
+	filters map[string][]string // terms accepted by each filter field
+}
+
+// checkInterval is the number of postings scored between checks of the search context.
+const checkInterval = 1024
+
+// search evaluates the query text against src and returns results sorted by score,
+// only the limit best ones if limit is positive. If ctx is done before all postings
+// are scored, the results scored so far are returned along with ctx.Err().
+func search(ctx context.Context, src termSource, text string, limit int) ([]SearchResult, error) {
+	analyzers, err := queryAnalyzers(ctx, src, text)
+	if err != nil {
+		return nil, err
+	}
+	q, err := expandClauses(ctx, src, parseQuery(text), analyzers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Filters drop results after scoring, so all of them are needed then
+	scoreLimit := limit
+	if len(q.filters) > 0 {
+		scoreLimit = 0
+	}
+	results, err := scoreGroups(ctx, src, q.groups, scoreLimit)
+	results = filterResults(src, results, q)
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, err
+}
+
+// searchContext implements SearchContext on src.
+func searchContext(ctx context.Context, src termSource, text string, opts SearchOptions) (SearchResponse, error) {
+	results, err := search(ctx, src, text, opts.Limit)
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) && opts.AllowPartialResults {
+		return SearchResponse{Results: results, TimedOut: true}, nil
+	}
+	if err != nil {
+		return SearchResponse{}, err
+	}
+	return SearchResponse{Results: results}, nil
+}
+
+// minParallelPostings is the number of postings below which a query is scored by a
+// single goroutine, as starting workers would take longer than scoring them.
+const minParallelPostings = 16384
+
+// scoreGroups scores every document matching the groups of weighted terms and
+// returns them sorted by score, only the limit best ones if limit is positive.
+// If ctx is done first, the documents scored so far are returned along with ctx.Err().
+//
+// Sources searched by several workers have their documents partitioned between
+// them by ranges of IDs, each scoring its own documents into its own scores without
+// locking. Postings are sorted by document ID, so each worker only reads its range.
+// The shards of a ShardedIndex are scored the same way, each by its own worker.
+func scoreGroups(ctx context.Context, src termSource, groups [][]weightedTerm, limit int) ([]SearchResult, error) {
+	if len(groups) == 0 {
+		return nil, nil
+	}
+
+	if sharded, ok := src.(*shardedSnapshot); ok {
+		return scoreShards(ctx, sharded, groups, limit)
+	}
+
+	workers := src.searchWorkers()
+	if workers <= 1 {
+		return scorePartition(ctx, src, groups, allDocs, limit)
+	}
+	n, longest := countPostings(src, groups)
+	if n < minParallelPostings {
+		return scorePartition(ctx, src, groups, allDocs, limit)
+	}
+
+	parts := partitions(longest, workers)
+	lists := make([][]SearchResult, len(parts))
+	errs := make([]error, len(parts))
+	var wg sync.WaitGroup
+	for i, p := range parts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lists[i], errs[i] = scorePartition(ctx, src, groups, p, limit)
+		}()
+	}
+	wg.Wait()
+	return mergeResults(lists, limit), firstError(errs)
+}
+
+// firstError returns the first non-nil error of errs, or nil.
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countPostings returns the number of postings of the terms and first phrase terms
+// of groups, along with the longest of their posting lists.
+func countPostings(src termSource, groups [][]weightedTerm) (int, IndexEntry) {
+	n := 0
+	var longest IndexEntry
+	for _, group := range groups {
+		for _, wt := range group {
+			term := wt.term
+			if wt.phrase != nil {
+				term = wt.phrase[0]
+			}
+			if entry, ok := src.fieldSource(wt.field).lookup(term); ok {
+				n += len(entry.DocIDs)
+				if len(entry.DocIDs) > len(longest.DocIDs) {
+					longest = entry
+				}
+			}
+		}
+	}
+	return n, longest
+}
+
+// partition selects the documents scored by a worker, those with IDs in [lo, hi).
+type partition struct {
+	lo, hi int
+}
+
+// allDocs is the partition of a single worker.
+var allDocs = partition{lo: math.MinInt, hi: math.MaxInt}
+
+// partitions splits the documents between n workers, in ranges of IDs holding
+// about as many postings of the longest posting list each.
+func partitions(longest IndexEntry, n int) []partition {
+	parts := make([]partition, n)
+	lo := math.MinInt
+	for i := range parts {
+		hi := math.MaxInt
+		if i < n-1 {
+			hi = longest.DocIDs[(i+1)*len(longest.DocIDs)/n]
+		}
+		parts[i] = partition{lo: lo, hi: hi}
+		lo = hi
+	}
+	return parts
+}
+
+// postings returns the range of the postings of entry in p, sorted by document ID.
+func (p partition) postings(entry IndexEntry) (int, int) {
+	if p == allDocs {
+		return 0, len(entry.DocIDs)
+	}
+	return sort.SearchInts(entry.DocIDs, p.lo), sort.SearchInts(entry.DocIDs, p.hi)
+}
+
+// scorePartition scores the documents of partition p matching the groups of weighted
+// terms, see scoreGroups.
+func scorePartition(ctx context.Context, src termSource, groups [][]weightedTerm, p partition, limit int) ([]SearchResult, error) {
+	// Calculate scores for each matching document
+	scores := make(map[int]float32)
+	docCount := src.numDocs()
+	var err error
+	for _, group := range groups {
+		if len(group) == 1 {
+			if err = scoreTerm(ctx, src, docCount, group[0], p, scores, addScore); err != nil {
+				break
+			}
+			continue
+		}
+
+		// Terms expanded from one clause compete rather than add up,
+		// so a document takes the score of its best matching term only
+		best := make(map[int]float32)
+		for _, wt := range group {
+			if err = scoreTerm(ctx, src, docCount, wt, p, best, bestScore); err != nil {
+				break
+			}
+		}
+		for docID, score := range best {
+			scores[docID] += score
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if len(scores) == 0 {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(scores))
+	for docID, score := range scores {
+		if !src.live(docID) {
+			continue
+		}
+		results = append(results, SearchResult{
+			DocID: docID,
+			Score: score,
+		})
+	}
+
+	// Sort results by score (highest first)
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, err
+}
+
+// mergeResults merges lists of results sorted by score into one sorted list,
+// keeping only the limit best results if limit is positive.
+func mergeResults(lists [][]SearchResult, limit int) []SearchResult {
+	h := make(resultHeap, 0, len(lists))
+	total := 0
+	for _, list := range lists {
+		if len(list) > 0 {
+			h = append(h, list)
+			total += len(list)
+		}
+	}
+	if limit > 0 {
+		total = min(total, limit)
+	}
+	if total == 0 {
+		return nil
+	}
+
+	heap.Init(&h)
+	results := make([]SearchResult, 0, total)
+	for len(results) < total {
+		results = append(results, h[0][0])
+		if h[0] = h[0][1:]; len(h[0]) == 0 {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+	return results
+}
+
+// resultHeap is a max-heap of sorted result lists ordered by their first result.
+type resultHeap [][]SearchResult
+
+func (h resultHeap) Len() int           { return len(h) }
+func (h resultHeap) Less(i, j int) bool { return h[i][0].Score > h[j][0].Score }
+func (h resultHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *resultHeap) Push(x any)        { *h = append(*h, x.([]SearchResult)) }
+func (h *resultHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// addScore and bestScore combine a term score into a document's accumulated score.
+func addScore(acc, score float32) float32  { return acc + score }
+func bestScore(acc, score float32) float32 { return max(acc, score) }
+
+// scoreTerm scores every posting of a weighted term in partition p into scores
+// using combine, stopping with ctx.Err() if ctx is done first.
+func scoreTerm(ctx context.Context, src termSource, docCount int, wt weightedTerm, p partition, scores map[int]float32, combine func(acc, score float32) float32) error {
+	if wt.phrase != nil {
+		return scorePhrase(ctx, src, docCount, wt, p, scores, combine)
+	}
+	fieldSrc := src.fieldSource(wt.field)
+	entry, ok := fieldSrc.lookup(wt.term)
+	if !ok {
+		return nil
+	}
+	idf := inverseDocFreq(docCount, fieldSrc.docFreq(wt.term)) * wt.weight
+	lo, hi := p.postings(entry)
+	for i := lo; i < hi; i++ {
+		if (i-lo)%checkInterval == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// Score is TF (from entry.Freqs) * IDF (calculated now)
+		docID := entry.DocIDs[i]
+		scores[docID] = combine(scores[docID], entry.Freqs[i]*idf)
+	}
+	return nil
+}
+
+// scorePhrase scores every document containing the terms of a weighted phrase at
+// consecutive positions in partition p. A phrase scores as the sum of its terms.
+// Postings are sorted by document ID, so those of the terms are intersected by
+// moving a cursor through each of them.
+func scorePhrase(ctx context.Context, src termSource, docCount int, wt weightedTerm, p partition, scores map[int]float32, combine func(acc, score float32) float32) error {
+	fieldSrc := src.fieldSource(wt.field)
+	entries := make([]IndexEntry, len(wt.phrase))
+	idfs := make([]float32, len(wt.phrase))
+	cursors := make([]int, len(wt.phrase)) // next posting of each term to compare
+	ends := make([]int, len(wt.phrase))
+	for i, term := range wt.phrase {
+		entry, ok := fieldSrc.lookup(term)
+		if !ok {
+			return nil
+		}
+		entries[i] = entry
+		idfs[i] = inverseDocFreq(docCount, fieldSrc.docFreq(term)) * wt.weight
+		cursors[i], ends[i] = p.postings(entry)
+	}
+
+	matched := make([]int, len(entries))
+	for j := cursors[0]; j < ends[0]; j++ {
+		if (j-cursors[0])%checkInterval == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		docID := entries[0].DocIDs[j]
+		matched[0] = j
+		score := entries[0].Freqs[j] * idfs[0]
+		found := true
+		for i := 1; i < len(entries) && found; i++ {
+			for cursors[i] < ends[i] && entries[i].DocIDs[cursors[i]] < docID {
+				cursors[i]++
+			}
+			matched[i] = cursors[i]
+			if found = cursors[i] < ends[i] && entries[i].DocIDs[cursors[i]] == docID; found {
+				score += entries[i].Freqs[matched[i]] * idfs[i]
+			}
+		}
+		if found && phraseMatches(entries, matched, wt.offset) {
+			scores[docID] = combine(scores[docID], score)
+		}
+	}
+	return nil
+}
+
+// phraseMatches reports whether the i-th entry has a position following that of
+// the previous entry, or offset[i] positions after the first one if offset is set,
+// in the postings matched[i] of a single document.
+func phraseMatches(entries []IndexEntry, matched []int, offset []int) bool {
+	positions := make([][]int, len(entries))
+	for i, entry := range entries {
+		positions[i] = entry.Positions.At(matched[i])
+	}
+	for _, start := range positions[0] {
+		found := true
+		for i := 1; i < len(entries) && found; i++ {
+			want := start + i
+			if offset != nil {
+				want = start + offset[i]
+			}
+			k := sort.SearchInts(positions[i], want)
+			found = k < len(positions[i]) && positions[i][k] == want
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// inverseDocFreq calculates the IDF of a term appearing in df of docCount documents.
+func inverseDocFreq(docCount, df int) float32 {
+	// IDF = log(N/(df + 1)) + 1
+	return float32(math.Log(float64(docCount)/(float64(df)+1.0)) + 1.0)
+}
+
+// queryAnalyzers returns the analyzers used to analyze a query. Indexes routing
+// documents to per-language analyzers analyze queries with every language present
+// in the index, unless query language detection is enabled and recognizes the query.
+func queryAnalyzers(ctx context.Context, src termSource, query string) ([]Analyzer, error) {
+	cfg := src.settings()
+	if cfg.detector == nil {
+		return []Analyzer{cfg.analyzer}, nil
+	}
+	if cfg.detectQuery {
+		if lang := cfg.detector.Detect(query); lang != "" {
+			return []Analyzer{cfg.analyzerFor(lang)}, nil
+		}
+	}
+
+	analyzers := []Analyzer{cfg.analyzer}
+	if langSrc := src.fieldSource(FieldLang); langSrc != nil {
+		dict, err := langSrc.dictionary(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, lang := range dict.terms {
+			if a, ok := cfg.langAnalyzers[Language(lang)]; ok {
+				analyzers = append(analyzers, a)
+			}
+		}
+	}
+	return analyzers, nil
+}
+
+// expandClauses turns query clauses into groups of weighted index terms, each
+// group being scored as a single clause. Clauses on filter fields become filters.
+// Clauses on the default field are analyzed with analyzers, other fields use their own.
+// Expanding terms from the dictionary stops with ctx.Err() once ctx is done.
+func expandClauses(ctx context.Context, src termSource, clauses []queryClause, analyzers []Analyzer) (expandedQuery, error) {
+	var q expandedQuery
+	for _, clause := range mergeTextClauses(clauses) {
+		if err := ctx.Err(); err != nil {
+			return q, err
+		}
+		fieldSrc := src.fieldSource(clause.field)
+		if fieldSrc == nil {
+			// Not a field after all, e.g. the scheme of a URL
+			fieldSrc = src
+			if clause.kind == textClause {
+				clause.text = clause.field + ":" + clause.text
+			}
+			clause.field = ""
+		}
+		fieldAnalyzers := analyzers
+		if fieldSrc != src {
+			fieldAnalyzers = []Analyzer{fieldSrc.settings().searchAnalyzer()}
+		}
+
+		if fieldSrc.settings().filter {
+			if q.filters == nil {
+				q.filters = make(map[string][]string)
+			}
+			q.filters[clause.field] = append(q.filters[clause.field], fieldSrc.settings().searchAnalyzer().Analyze(clause.text)...)
+			continue
+		}
+
+		var group []weightedTerm
+		var forms []string
+		switch clause.kind {
+		case textClause:
+			for _, group := range analyzeClause(fieldAnalyzers, fieldSrc.settings(), clause.text) {
+				for i := range group {
+					group[i].field = clause.field
+				}
+				q.groups = append(q.groups, group)
+			}
+			continue
+		case phraseClause:
+			var err error
+			group, err = analyzePhrase(fieldSrc, fieldAnalyzers, clause)
+			if err != nil {
+				return q, err
+			}
+		case fuzzyClause:
+			var err error
+			group, err = expandFuzzy(ctx, fieldSrc, fieldAnalyzers, clause)
+			if err != nil {
+				return q, err
+			}
+		case prefixClause, wildcardClause, rangeClause:
+			dict, err := fieldSrc.dictionary(ctx)
+			if err != nil {
+				return q, err
+			}
+			switch clause.kind {
+			case prefixClause:
+				forms = dict.withPrefix(surfacePattern(fieldAnalyzers[0], clause.text))
+			case wildcardClause:
+				pattern := surfacePattern(fieldAnalyzers[0], clause.text)
+				if forms, err = dict.wildcard(ctx, pattern, fieldSrc.maxExpansions()); err != nil {
+					return q, err
+				}
+			default:
+				lower := surfacePattern(fieldAnalyzers[0], clause.lower)
+				upper := surfacePattern(fieldAnalyzers[0], clause.upper)
+				forms = dict.between(lower, upper, clause.includeLower, clause.includeUpper)
+			}
+		}
+
+		if clause.kind != fuzzyClause && clause.kind != phraseClause {
+			if len(forms) > fieldSrc.maxExpansions() {
+				return q, tooManyExpansions(fieldSrc, clause)
+			}
+			group = normalizeForms(fieldAnalyzers, forms)
+		}
+		if len(group) > 0 {
+			for i := range group {
+				group[i].field = clause.field
+			}
+			q.groups = append(q.groups, group)
+		}
+	}
+	return q, nil
+}
+
+// mergeTextClauses joins consecutive text clauses on the same field, so that
+// multi-word synonyms match across them.
+func mergeTextClauses(clauses []queryClause) []queryClause {
+	merged := make([]queryClause, 0, len(clauses))
+	for _, clause := range clauses {
+		if n := len(merged); n > 0 && clause.kind == textClause &&
+			merged[n-1].kind == textClause && merged[n-1].field == clause.field {
+			merged[n-1].text += " " + clause.text
+			continue
+		}
+		merged = append(merged, clause)
+	}
+	return merged
+}
+
+// analyzeClause analyzes the text of a clause into one group per token, or per
+// sequence of tokens matching a synonym rule, its synonyms being alternatives in
+// the group. Tokens stacked at the position of the previous one are alternatives
+// too. With several analyzers, the i-th groups of every analyzer are merged, so
+// analyzing in more languages does not add up scores either.
+func analyzeClause(analyzers []Analyzer, cfg *indexConfig, text string) [][]weightedTerm {
+	var groups [][]weightedTerm
+	seen := make([]map[string]bool, 0)
+	for _, a := range analyzers {
+		slots := cfg.querySynonyms().expand(analyzeSurface(a, text))
+		if cfg.keptStopwords != nil {
+			slots = withoutStopwords(slots, cfg.keptStopwords)
+		}
+		i := -1
+		for _, slot := range slots {
+			if i < 0 || slot.tokens[0].PositionIncrement > 0 {
+				i++
+			}
+			if i == len(groups) {
+				groups = append(groups, nil)
+				seen = append(seen, make(map[string]bool))
+			}
+			for _, words := range slot.alternatives {
+				terms := normalizeTerms(a, words)
+				if len(terms) == 0 {
+					continue
+				}
+				wt := newWeightedTerm(terms, 1)
+				if !seen[i][wt.key()] {
+					seen[i][wt.key()] = true
+					groups[i] = append(groups[i], wt)
+				}
+			}
+		}
+	}
+	return groups
+}
+
+// withoutStopwords removes the slots made of a single stop word, unless all of them are.
+func withoutStopwords(slots []synonymSlot, stopwords StopwordSet) []synonymSlot {
+	r := make([]synonymSlot, 0, len(slots))
+	for _, slot := range slots {
+		if len(slot.alternatives) != 1 || len(slot.alternatives[0]) != 1 || !stopwords.Contains(slot.alternatives[0][0]) {
+			r = append(r, slot)
+		}
+	}
+	if len(r) == 0 {
+		return slots
+	}
+	return r
+}
+
+// analyzePhrase returns the phrases matched by a phrase clause: one per analyzer
+// and, with synonyms, one per combination of synonyms of its words. Words keep
+// their relative positions, so words removed by analysis, such as stop words,
+// match any word. Synonyms shift the words following them by their difference
+// in length with the words they replace.
+func analyzePhrase(src termSource, analyzers []Analyzer, clause queryClause) ([]weightedTerm, error) {
+	var group []weightedTerm
+	seen := make(map[string]bool)
+	for _, a := range analyzers {
+		type partialPhrase struct {
+			tokens []Token
+			shift  int // difference between positions in the phrase and in the clause
+		}
+		phrases := []partialPhrase{{}}
+		for _, slot := range src.settings().querySynonyms().expand(analyzeSurface(a, clause.text)) {
+			if len(phrases)*len(slot.alternatives) > src.maxExpansions() {
+				return nil, tooManyExpansions(src, clause)
+			}
+			next := make([]partialPhrase, 0, len(phrases)*len(slot.alternatives))
+			for _, phrase := range phrases {
+				for _, words := range slot.alternatives {
+					tokens := phrase.tokens[:len(phrase.tokens):len(phrase.tokens)]
+					for i, word := range words {
+						tokens = append(tokens, Token{Term: word, Position: slot.position() + phrase.shift + i})
+					}
+					next = append(next, partialPhrase{tokens: tokens, shift: phrase.shift + len(words) - slot.width()})
+				}
+			}
+			phrases = next
+		}
+
+		for _, phrase := range phrases {
+			tokens := normalize(a, phrase.tokens)
+			if len(tokens) == 0 {
+				continue
+			}
+			wt := newPhraseTerm(tokens, 1)
+			if common := src.settings().commonGrams; common != nil && len(tokens) > 1 {
+				// Grams are missing from fields whose analyzer changes the number of
+				// tokens, and from documents without the phrase, matched either way
+				if gramPhrase := commonGramPhrase(common, phrase.tokens, tokens); indexed(src, gramPhrase) {
+					wt = gramPhrase
+				}
+			}
+			if !seen[wt.key()] {
+				seen[wt.key()] = true
+				group = append(group, wt)
+			}
+		}
+	}
+	return group, nil
+}
+
+// filterResults keeps the results accepted by every filter field of q. Filtering
+// on a field accepts documents matching any of its terms. A query made only of
+// filters returns every accepted document, in ID order and with a zero score.
+func filterResults(src termSource, results []SearchResult, q expandedQuery) []SearchResult {
+	if len(q.filters) == 0 {
+		return results
+	}
+
+	var accepted map[int]bool
+	for field, terms := range q.filters {
+		fieldAccepted := make(map[int]bool)
+		for _, term := range terms {
+			entry, _ := src.fieldSource(field).lookup(term)
+			for _, docID := range entry.DocIDs {
+				if accepted == nil || accepted[docID] {
+					fieldAccepted[docID] = true
+				}
+			}
+		}
+		accepted = fieldAccepted
+	}
+
+	if len(q.groups) == 0 {
+		results = make([]SearchResult, 0, len(accepted))
+		for docID := range accepted {
+			if src.live(docID) {
+				results = append(results, SearchResult{DocID: docID})
+			}
+		}
+		sort.Slice(results, func(i, j int) bool {
+			return results[i].DocID < results[j].DocID
+		})
+		return results
+	}
+
+	filtered := results[:0]
+	for _, result := range results {
+		if accepted[result.DocID] {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
+
+// commonGramPhrase returns the phrase of tokens, given their surface forms, matched
+// with common grams: pairs of words containing a common word are replaced with
+// their gram, see WithCommonGrams.
+func commonGramPhrase(common StopwordSet, surface, tokens []Token) weightedTerm {
+	grams := commonGrams(common, surface, tokens)
+	if len(grams) == 0 {
+		return newPhraseTerm(tokens, 1)
+	}
+
+	covered := make(map[int]bool)
+	for _, gram := range grams {
+		covered[gram.Position], covered[gram.Position+1] = true, true
+	}
+	var phrase []Token
+	g := 0
+	for _, token := range tokens {
+		for g < len(grams) && grams[g].Position == token.Position {
+			phrase = append(phrase, grams[g])
+			g++
+		}
+		if !covered[token.Position] {
+			phrase = append(phrase, token)
+		}
+	}
+	return newPhraseTerm(phrase, 1)
+}
+
+// indexed reports whether every term matched by wt is indexed in src.
+func indexed(src termSource, wt weightedTerm) bool {
+	terms := wt.phrase
+	if terms == nil {
+		terms = []string{wt.term}
+	}
+	for _, term := range terms {
+		if _, ok := src.lookup(term); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// tooManyExpansions returns the error for a clause exceeding the maximum expansion count.
+func tooManyExpansions(src termSource, clause queryClause) error {
+	return fmt.Errorf("%w: %q matches more than %d terms", ErrTooManyExpansions, clause.text, src.maxExpansions())
+}
+
+// normalizeForms maps the surface forms matched by a clause to their index terms.
+func normalizeForms(analyzers []Analyzer, forms []string) []weightedTerm {
+	var terms []string
+	for _, a := range analyzers {
+		terms = append(terms, normalizeTerms(a, forms)...)
+	}
+	terms = uniqueTokens(terms)
+	group := make([]weightedTerm, len(terms))
+	for i, term := range terms {
+		group[i] = weightedTerm{term: term, weight: 1}
+	}
+	return group
+}
+
+// expandFuzzy returns the index terms of all surface forms within the clause's
+// edit distance. Matching surface forms rather than stems means a misspelling is
+// compared to the words users actually type. Each term is weighted down by its
+// distance relative to the word length, so exact matches always score highest.
+func expandFuzzy(ctx context.Context, src termSource, analyzers []Analyzer, clause queryClause) ([]weightedTerm, error) {
+	word, ok := querySurface(analyzers[0], clause.text)
+	if !ok {
+		return nil, nil
+	}
+
+	dict, err := src.dictionary(ctx)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := dict.fuzzy(ctx, word, clause.distance)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) > src.maxExpansions() {
+		return nil, tooManyExpansions(src, clause)
+	}
+
+	wordLen := utf8.RuneCountInString(word)
+	weights := make(map[string]float32)
+	var terms []string
+	for _, match := range matches {
+		shortest := min(wordLen, utf8.RuneCountInString(match.Term))
+		weight := 1 - float32(match.Distance)/float32(shortest)
+		if weight <= 0 {
+			continue
+		}
+
+		// Several surface forms may share a stem, keep the best weight
+		for _, wt := range normalizeForms(analyzers, []string{match.Term}) {
+			term := wt.term
+			if prev, seen := weights[term]; !seen {
+				terms = append(terms, term)
+				weights[term] = weight
+			} else {
+				weights[term] = max(prev, weight)
+			}
+		}
+	}
+
+	group := make([]weightedTerm, len(terms))
+	for i, term := range terms {
+		group[i] = weightedTerm{term: term, weight: weights[term]}
+	}
+	return group, nil
+}
@@ -0,0 +1,277 @@
+package utils
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// segment holds the postings of documents added to a ConcurrentIndex together.
+// It is never modified once published, so searches read it without locking.
+type segment struct {
+	entries  map[string]IndexEntry
+	store    *docStore      // stored fields of the documents, nil in the segments of fields
+	keys     map[string]int // key -> latest ID of the documents with one
+	surfaces map[string]int // unstemmed term -> document frequency
+	docCount int
+	tokens   int64 // number of index terms of the documents
+
+	// Statistics of the documents of earlier segments replaced by those added
+	// with this one, subtracted from those of the snapshot
+	removed removedStats
+}
+
+// mergeSegments returns a segment with the documents of all segs, in order.
+// The postings of segs are copied, as older snapshots may still read them.
+func mergeSegments(segs []*segment) *segment {
+	merged := &segment{
+		entries:  make(map[string]IndexEntry),
+		surfaces: make(map[string]int),
+		keys:     make(map[string]int),
+	}
+	if segs[0].store != nil {
+		stores := make([]*docStore, len(segs))
+		for i, seg := range segs {
+			stores[i] = seg.store
+		}
+		merged.store = mergeStores(stores)
+	}
+	for _, seg := range segs {
+		for term, entry := range seg.entries {
+			merged.entries[term] = appendEntry(merged.entries[term], entry)
+		}
+		for form, df := range seg.surfaces {
+			merged.surfaces[form] += df
+		}
+		for key, id := range seg.keys {
+			merged.keys[key] = max(merged.keys[key], id)
+		}
+		merged.docCount += seg.docCount
+		merged.tokens += seg.tokens
+		merged.removed.merge(seg.removed)
+	}
+	return merged
+}
+
+// appendEntry returns the postings of dst followed by those of src, never
+// writing to the arrays of dst.
+func appendEntry(dst, src IndexEntry) IndexEntry {
+	return IndexEntry{
+		DocIDs:    append(dst.DocIDs[:len(dst.DocIDs):len(dst.DocIDs)], src.DocIDs...),
+		Freqs:     append(dst.Freqs[:len(dst.Freqs):len(dst.Freqs)], src.Freqs...),
+		Positions: appendPositions(dst.Positions, src.Positions),
+	}
+}
+
+// sortPostings returns the postings of entry sorted by document ID, as the workers
+// indexing a segment add them in any order. Segments then hold increasing IDs, so
+// the postings of a snapshot are sorted too, see assignIDs.
+func sortPostings(entry IndexEntry) IndexEntry {
+	if sort.IntsAreSorted(entry.DocIDs) {
+		return entry
+	}
+	order := make([]int, len(entry.DocIDs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return entry.DocIDs[order[a]] < entry.DocIDs[order[b]]
+	})
+	sorted := IndexEntry{
+		DocIDs: make([]int, len(order)),
+		Freqs:  make([]float32, len(order)),
+	}
+	for i, j := range order {
+		sorted.DocIDs[i] = entry.DocIDs[j]
+		sorted.Freqs[i] = entry.Freqs[j]
+		sorted.Positions.addEncoded(entry.Positions.bytes(j))
+	}
+	return sorted
+}
+
+// indexSnapshot is a point-in-time view of a ConcurrentIndex and its fields.
+// Searches run against the snapshot published when they start, so documents
+// being added are only seen once the Add adding them returns.
+type indexSnapshot struct {
+	idx      *ConcurrentIndex
+	segments []*segment
+	fields   map[string]*indexSnapshot
+	docCount int
+	replaced map[int]struct{} // IDs of documents replaced by a later one with the same key
+	nextID   int              // next ID assigned to a document with a key
+
+	dict lazyDict // sorted surface forms, built on first use
+
+	statsOnce sync.Once
+	stats     IndexStats // statistics from the postings, computed on first use
+}
+
+// emptySnapshot returns a snapshot of idx and its fields without documents.
+func emptySnapshot(idx *ConcurrentIndex) *indexSnapshot {
+	s := &indexSnapshot{idx: idx, fields: make(map[string]*indexSnapshot, len(idx.fields))}
+	for name, fieldIdx := range idx.fields {
+		s.fields[name] = emptySnapshot(fieldIdx)
+	}
+	return s
+}
+
+// withSegment returns a snapshot with the segments of s followed by seg, if it
+// has documents or replaces some, and with the field snapshots fields.
+// Segments are merged like a binary counter, while the previous one has no more
+// documents than the last, which keeps their number logarithmic in the number of
+// documents and merges each document a logarithmic number of times.
+func (s *indexSnapshot) withSegment(seg *segment, fields map[string]*indexSnapshot) *indexSnapshot {
+	segs := s.segments
+	if seg.docCount > 0 || seg.removed.docs > 0 {
+		segs = append(segs[:len(segs):len(segs)], seg)
+	}
+	for n := len(segs); n > 1 && segs[n-2].docCount <= segs[n-1].docCount; n = len(segs) {
+		segs = append(segs[:n-2], mergeSegments(segs[n-2:]))
+	}
+	return &indexSnapshot{
+		idx:      s.idx,
+		segments: segs,
+		fields:   fields,
+		docCount: s.docCount + seg.docCount - seg.removed.docs,
+		replaced: s.replaced,
+		nextID:   s.nextID,
+	}
+}
+
+// id returns the ID of the document indexed with key, if any. The latest
+// document with a key has the highest ID, see assignIDs.
+func (s *indexSnapshot) id(key string) (int, bool) {
+	found, latest := false, 0
+	for _, seg := range s.segments {
+		if id, ok := seg.keys[key]; ok && (!found || id > latest) {
+			found, latest = true, id
+		}
+	}
+	return latest, found
+}
+
+// has reports whether the document docID is indexed, even if it was replaced.
+func (s *indexSnapshot) has(docID int) bool {
+	for _, seg := range s.segments {
+		if seg.store.has(docID) {
+			return true
+		}
+	}
+	return false
+}
+
+// stores returns the document stores of the segments, newest first.
+func (s *indexSnapshot) stores() []*docStore {
+	stores := make([]*docStore, len(s.segments))
+	for i, seg := range s.segments {
+		stores[len(stores)-1-i] = seg.store
+	}
+	return stores
+}
+
+// surfaceForms returns the unstemmed terms of the snapshot with their document frequencies.
+func (s *indexSnapshot) surfaceForms() map[string]int {
+	forms := make(map[string]int)
+	for _, seg := range s.segments {
+		for form, df := range seg.surfaces {
+			forms[form] += df
+		}
+		for form, df := range seg.removed.surfaces {
+			forms[form] -= df
+		}
+	}
+	for form, df := range forms {
+		if df <= 0 {
+			delete(forms, form)
+		}
+	}
+	return forms
+}
+
+// vocabulary returns the distinct index terms of the snapshot.
+func (s *indexSnapshot) vocabulary() []string {
+	seen := make(map[string]struct{})
+	var terms []string
+	for _, seg := range s.segments {
+		for term := range seg.entries {
+			if _, ok := seen[term]; !ok {
+				seen[term] = struct{}{}
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
+
+// tokens returns the number of index terms of the documents of the snapshot.
+func (s *indexSnapshot) tokens() int64 {
+	var n int64
+	for _, seg := range s.segments {
+		n += seg.tokens - seg.removed.tokens
+	}
+	return n
+}
+
+func (s *indexSnapshot) live(docID int) bool {
+	_, ok := s.replaced[docID]
+	return !ok
+}
+
+func (s *indexSnapshot) numDocs() int {
+	return s.docCount
+}
+
+func (s *indexSnapshot) lookup(term string) (IndexEntry, bool) {
+	var r IndexEntry
+	found := false
+	for _, seg := range s.segments {
+		entry, ok := seg.entries[term]
+		if !ok {
+			continue
+		}
+		if found {
+			r = appendEntry(r, entry)
+		} else {
+			r, found = entry, true
+		}
+	}
+	return r, found
+}
+
+func (s *indexSnapshot) docFreq(term string) int {
+	df := 0
+	for _, seg := range s.segments {
+		df += len(seg.entries[term].DocIDs) - seg.removed.df[term]
+	}
+	return df
+}
+
+func (s *indexSnapshot) dictionary(ctx context.Context) (*termDict, error) {
+	return s.dict.get(ctx, s.surfaceForms)
+}
+
+func (s *indexSnapshot) maxExpansions() int {
+	return s.idx.config.maxExpansions
+}
+
+func (s *indexSnapshot) Analyzer() Analyzer {
+	return s.idx.config.analyzer
+}
+
+func (s *indexSnapshot) fieldSource(name string) termSource {
+	if name == "" || name == s.idx.field {
+		return s
+	}
+	if field, ok := s.fields[name]; ok {
+		return field
+	}
+	return nil
+}
+
+func (s *indexSnapshot) settings() *indexConfig {
+	return &s.idx.config
+}
+
+func (s *indexSnapshot) searchWorkers() int {
+	return s.idx.searchWorkers()
+}
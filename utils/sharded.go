@@ -0,0 +1,482 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// ShardedIndex is an index split into shards, each holding the documents whose
+// IDs hash to it. Documents are added to all shards in parallel, and queries are
+// scored in every shard concurrently before the best results are merged.
+//
+// Scores are those of a single index holding all of the documents: queries are
+// expanded against the terms of all shards, and IDF is computed from the document
+// frequencies of the whole index rather than of each shard.
+type ShardedIndex struct {
+	sync.Mutex // serializes Add and Clear
+	shards     []*ConcurrentIndex
+	current    atomic.Pointer[shardedSnapshot]
+	config     indexConfig
+}
+
+// NewShardedIndex creates a ShardedIndex with n shards, at least one.
+func NewShardedIndex(n int, opts ...IndexOption) *ShardedIndex {
+	idx := &ShardedIndex{
+		shards: make([]*ConcurrentIndex, max(n, 1)),
+		config: newIndexConfig(opts),
+	}
+	snapshots := make([]*indexSnapshot, len(idx.shards))
+	for i := range idx.shards {
+		idx.shards[i] = newConcurrentFieldIndex(FieldText, idx.config)
+		idx.shards[i].storeDocs = true
+		snapshots[i] = emptySnapshot(idx.shards[i])
+	}
+	idx.current.Store(newShardedSnapshot(FieldText, snapshots))
+	return idx
+}
+
+// snapshot returns the last published view of the shards.
+func (idx *ShardedIndex) snapshot() *shardedSnapshot {
+	return idx.current.Load()
+}
+
+// shardOf returns the shard of the document docID. Consecutive IDs are spread
+// evenly by Fibonacci hashing.
+func (idx *ShardedIndex) shardOf(docID int) int {
+	h := uint64(docID) * 0x9E3779B97F4A7C15
+	return int((h >> 32) % uint64(len(idx.shards)))
+}
+
+func (idx *ShardedIndex) Clear() {
+	idx.Lock()
+	defer idx.Unlock()
+	snapshots := make([]*indexSnapshot, len(idx.shards))
+	for i, shard := range idx.shards {
+		snapshots[i] = emptySnapshot(shard)
+	}
+	idx.current.Store(newShardedSnapshot(FieldText, snapshots))
+}
+
+// DocumentCount returns the number of documents indexed in all shards, replaced ones excluded.
+func (idx *ShardedIndex) DocumentCount() int {
+	return idx.snapshot().docCount
+}
+
+func (idx *ShardedIndex) Stats() IndexStats {
+	s := idx.snapshot()
+	s.statsOnce.Do(func() {
+		s.stats = indexStats(s, s.vocabulary(), s.tokens())
+	})
+	return s.stats
+}
+
+// TermStats returns the statistics of an index term in all shards, as produced by the analyzer.
+func (idx *ShardedIndex) TermStats(term string) (TermStats, bool) {
+	return termStats(idx.snapshot(), term)
+}
+
+// TopTerms returns the statistics of the n index terms occurring most often in all shards.
+func (idx *ShardedIndex) TopTerms(n int) []TermStats {
+	s := idx.snapshot()
+	return topTerms(s, s.vocabulary(), n)
+}
+
+// Add adds documents to the shards their IDs hash to, indexing the shards in parallel.
+func (idx *ShardedIndex) Add(docs []*Document) {
+	idx.AddContext(context.Background(), docs)
+}
+
+// AddContext is like Add but stops adding documents once ctx is done, returning
+// ctx.Err(). The documents added to each shard until then, a prefix of those
+// hashing to it, stay indexed. They become visible to searches all at once.
+// A document with a key replaces the one indexed before in whichever shard holds it.
+func (idx *ShardedIndex) AddContext(ctx context.Context, docs []*Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	idx.Lock()
+	defer idx.Unlock()
+	s := idx.snapshot()
+	nextID := s.nextID
+	assignIDs(docs, &nextID)
+
+	parts := make([][]*Document, len(idx.shards))
+	for _, doc := range docs {
+		i := idx.shardOf(doc.ID)
+		parts[i] = append(parts[i], doc)
+	}
+
+	snapshots := make([]*indexSnapshot, len(idx.shards))
+	errs := make([]error, len(idx.shards))
+	var wg sync.WaitGroup
+	for i, shard := range idx.shards {
+		if len(parts[i]) == 0 {
+			snapshots[i] = s.shards[i]
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			snapshots[i], errs[i] = shard.addSegment(ctx, s.shards[i], parts[i])
+		}()
+	}
+	wg.Wait()
+
+	// Replaced documents are left out of the statistics of the shards holding them
+	next := newShardedSnapshot(FieldText, snapshots)
+	replaced := replacedDocs(docs, next.has, s.id)
+	if len(replaced) > 0 {
+		byShard := make([][]int, len(idx.shards))
+		for _, id := range replaced {
+			i := idx.shardOf(id)
+			byShard[i] = append(byShard[i], id)
+		}
+		for i, ids := range byShard {
+			old, err := documents(ids, nil, snapshots[i].stores()...)
+			errs = append(errs, err)
+			snapshots[i] = idx.shards[i].withRemoved(snapshots[i], old)
+		}
+		next = newShardedSnapshot(FieldText, snapshots)
+	}
+	next.nextID = nextID
+	next.replaced = withReplaced(s.replaced, replaced)
+	idx.current.Store(next)
+	return firstError(errs)
+}
+
+// SurfaceForms returns the unstemmed terms seen while indexing, mapped to the
+// number of documents containing them.
+func (idx *ShardedIndex) SurfaceForms() map[string]int {
+	return idx.snapshot().surfaceForms()
+}
+
+// Search queries all shards for the given text and returns scored results.
+// Queries that cannot be evaluated return no results, use Query to get the error.
+func (idx *ShardedIndex) Search(text string) []SearchResult {
+	results, _ := idx.Query(text)
+	return results
+}
+
+// Query is like Search but reports queries that cannot be evaluated,
+// such as a prefix matching more terms than the maximum expansion count.
+func (idx *ShardedIndex) Query(text string) ([]SearchResult, error) {
+	return search(context.Background(), idx.snapshot(), text, 0)
+}
+
+// SearchContext is like Query but stops scoring once ctx is done. The documents
+// scored until then are returned as a timed out response if opts allows partial
+// results, otherwise ctx.Err() is returned.
+func (idx *ShardedIndex) SearchContext(ctx context.Context, text string, opts SearchOptions) (SearchResponse, error) {
+	return searchContext(ctx, idx.snapshot(), text, opts)
+}
+
+// Explain returns how the score of docID for the query text is computed. Its value
+// is the score of the document in the results of Search, or zero if it does not match.
+func (idx *ShardedIndex) Explain(text string, docID int) (Explanation, error) {
+	s := idx.snapshot()
+	if !s.shards[idx.shardOf(docID)].has(docID) || !s.live(docID) {
+		return Explanation{}, ErrDocumentNotFound
+	}
+	return explain(s, text, docID)
+}
+
+// Analyzer returns the analyzer used for indexed documents and queries.
+func (idx *ShardedIndex) Analyzer() Analyzer {
+	return idx.config.analyzer
+}
+
+// FieldAnalyzer returns the analyzer used for queries on field, if it is indexed.
+func (idx *ShardedIndex) FieldAnalyzer(field string) (Analyzer, bool) {
+	return idx.config.fieldAnalyzer(field)
+}
+
+// LanguageAnalyzer returns the analyzer used for documents and queries in lang,
+// if the index detects languages.
+func (idx *ShardedIndex) LanguageAnalyzer(lang Language) (Analyzer, bool) {
+	return idx.config.languageAnalyzer(lang)
+}
+
+// MoreLikeThis returns the documents most similar to the indexed document docID,
+// excluding the document itself.
+func (idx *ShardedIndex) MoreLikeThis(docID int, opts MoreLikeThisOptions) ([]SearchResult, error) {
+	s := idx.snapshot()
+	docs, err := documents([]int{docID}, s.replaced, s.shards[idx.shardOf(docID)].stores()...)
+	if err != nil {
+		return nil, err
+	}
+	return moreLikeThis(s, docs[0].Text, docID, opts), nil
+}
+
+// Get returns the stored document docID, or ErrDocumentNotFound if it is not indexed.
+func (idx *ShardedIndex) Get(docID int) (*Document, error) {
+	docs, err := idx.GetMany([]int{docID})
+	if err != nil {
+		return nil, err
+	}
+	return docs[0], nil
+}
+
+// GetMany returns the stored documents ids, in order, or ErrDocumentNotFound
+// if one of them is not indexed.
+func (idx *ShardedIndex) GetMany(ids []int) ([]*Document, error) {
+	s := idx.snapshot()
+	var stores []*docStore
+	for _, shard := range s.shards {
+		stores = append(stores, shard.stores()...)
+	}
+	return documents(ids, s.replaced, stores...)
+}
+
+// IDs returns the IDs of the indexed documents in all shards, in increasing order.
+func (idx *ShardedIndex) IDs() []int {
+	s := idx.snapshot()
+	var stores []*docStore
+	for _, shard := range s.shards {
+		stores = append(stores, shard.stores()...)
+	}
+	return storedIDs(s.replaced, stores...)
+}
+
+// ID returns the internal ID of the document indexed with key, if any.
+func (idx *ShardedIndex) ID(key string) (int, bool) {
+	return idx.snapshot().id(key)
+}
+
+// Key returns the key of the document docID, if it is indexed with one.
+func (idx *ShardedIndex) Key(docID int) (string, bool) {
+	doc, err := idx.Get(docID)
+	if err != nil || doc.Key == "" {
+		return "", false
+	}
+	return doc.Key, true
+}
+
+// MoreLikeThisText returns the documents most similar to text.
+func (idx *ShardedIndex) MoreLikeThisText(text string, opts MoreLikeThisOptions) []SearchResult {
+	return moreLikeThis(idx.snapshot(), text, -1, opts)
+}
+
+// shardedSnapshot is a point-in-time view of the shards of a ShardedIndex for one
+// document field, searched as a single source with the statistics of all shards.
+type shardedSnapshot struct {
+	field    string
+	shards   []*indexSnapshot
+	fields   map[string]*shardedSnapshot
+	docCount int
+	replaced map[int]struct{} // IDs of documents replaced by a later one with the same key, in any shard
+	nextID   int              // next ID assigned to a document with a key
+
+	dict lazyDict // sorted surface forms of all shards, built on first use
+
+	statsOnce sync.Once
+	stats     IndexStats // statistics from the postings, computed on first use
+}
+
+// newShardedSnapshot returns the view of the shard snapshots of field, along with
+// the views of their fields.
+func newShardedSnapshot(field string, shards []*indexSnapshot) *shardedSnapshot {
+	s := &shardedSnapshot{field: field, shards: shards, fields: make(map[string]*shardedSnapshot)}
+	for _, shard := range shards {
+		s.docCount += shard.docCount
+	}
+	for name := range shards[0].fields {
+		fieldShards := make([]*indexSnapshot, len(shards))
+		for i, shard := range shards {
+			fieldShards[i] = shard.fields[name]
+		}
+		s.fields[name] = newShardedSnapshot(name, fieldShards)
+	}
+	return s
+}
+
+// scoreShards scores the groups of weighted terms in every shard of s concurrently
+// and merges the results of the shards, see scoreGroups.
+func scoreShards(ctx context.Context, s *shardedSnapshot, groups [][]weightedTerm, limit int) ([]SearchResult, error) {
+	lists := make([][]SearchResult, len(s.shards))
+	errs := make([]error, len(s.shards))
+	var wg sync.WaitGroup
+	for i := range s.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lists[i], errs[i] = scoreGroups(ctx, shardView{global: s, i: i}, groups, limit)
+		}()
+	}
+	wg.Wait()
+	return mergeResults(lists, limit), firstError(errs)
+}
+
+// id returns the ID of the document indexed with key in any shard, if any.
+func (s *shardedSnapshot) id(key string) (int, bool) {
+	found, latest := false, 0
+	for _, shard := range s.shards {
+		if id, ok := shard.id(key); ok && (!found || id > latest) {
+			found, latest = true, id
+		}
+	}
+	return latest, found
+}
+
+// has reports whether the document docID is indexed in any shard, even if it was replaced.
+func (s *shardedSnapshot) has(docID int) bool {
+	for _, shard := range s.shards {
+		if shard.has(docID) {
+			return true
+		}
+	}
+	return false
+}
+
+// surfaceForms returns the unstemmed terms of all shards with their document frequencies.
+func (s *shardedSnapshot) surfaceForms() map[string]int {
+	forms := make(map[string]int)
+	for _, shard := range s.shards {
+		for form, df := range shard.surfaceForms() {
+			forms[form] += df
+		}
+	}
+	return forms
+}
+
+// vocabulary returns the distinct index terms of all shards.
+func (s *shardedSnapshot) vocabulary() []string {
+	seen := make(map[string]struct{})
+	var terms []string
+	for _, shard := range s.shards {
+		for _, term := range shard.vocabulary() {
+			if _, ok := seen[term]; !ok {
+				seen[term] = struct{}{}
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
+
+// tokens returns the number of index terms of the documents of all shards.
+func (s *shardedSnapshot) tokens() int64 {
+	var n int64
+	for _, shard := range s.shards {
+		n += shard.tokens()
+	}
+	return n
+}
+
+func (s *shardedSnapshot) live(docID int) bool {
+	_, ok := s.replaced[docID]
+	return !ok
+}
+
+func (s *shardedSnapshot) numDocs() int {
+	return s.docCount
+}
+
+func (s *shardedSnapshot) lookup(term string) (IndexEntry, bool) {
+	var r IndexEntry
+	found := false
+	for _, shard := range s.shards {
+		entry, ok := shard.lookup(term)
+		if !ok {
+			continue
+		}
+		if found {
+			r = appendEntry(r, entry)
+		} else {
+			r, found = entry, true
+		}
+	}
+	return r, found
+}
+
+func (s *shardedSnapshot) docFreq(term string) int {
+	df := 0
+	for _, shard := range s.shards {
+		df += shard.docFreq(term)
+	}
+	return df
+}
+
+func (s *shardedSnapshot) dictionary(ctx context.Context) (*termDict, error) {
+	return s.dict.get(ctx, s.surfaceForms)
+}
+
+func (s *shardedSnapshot) maxExpansions() int {
+	return s.shards[0].maxExpansions()
+}
+
+func (s *shardedSnapshot) Analyzer() Analyzer {
+	return s.shards[0].Analyzer()
+}
+
+func (s *shardedSnapshot) fieldSource(name string) termSource {
+	if name == "" || name == s.field {
+		return s
+	}
+	if field, ok := s.fields[name]; ok {
+		return field
+	}
+	return nil
+}
+
+func (s *shardedSnapshot) settings() *indexConfig {
+	return s.shards[0].settings()
+}
+
+func (s *shardedSnapshot) searchWorkers() int {
+	return len(s.shards)
+}
+
+// shardView is the i-th shard of a shardedSnapshot, scored with the number of
+// documents and document frequencies of all shards.
+type shardView struct {
+	global *shardedSnapshot
+	i      int
+}
+
+func (v shardView) numDocs() int {
+	return v.global.numDocs()
+}
+
+func (v shardView) live(docID int) bool {
+	return v.global.live(docID)
+}
+
+func (v shardView) lookup(term string) (IndexEntry, bool) {
+	return v.global.shards[v.i].lookup(term)
+}
+
+func (v shardView) docFreq(term string) int {
+	return v.global.docFreq(term)
+}
+
+func (v shardView) dictionary(ctx context.Context) (*termDict, error) {
+	return v.global.dictionary(ctx)
+}
+
+func (v shardView) maxExpansions() int {
+	return v.global.maxExpansions()
+}
+
+func (v shardView) Analyzer() Analyzer {
+	return v.global.Analyzer()
+}
+
+func (v shardView) fieldSource(name string) termSource {
+	if name == "" || name == v.global.field {
+		return v
+	}
+	if field, ok := v.global.fields[name]; ok {
+		return shardView{global: field, i: v.i}
+	}
+	return nil
+}
+
+func (v shardView) settings() *indexConfig {
+	return v.global.settings()
+}
+
+func (v shardView) searchWorkers() int {
+	return v.global.shards[v.i].searchWorkers()
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedIndex(t *testing.T) {
+	texts := []string{
+		"The quick brown fox jumps over the lazy dog",
+		"Pack my box with five dozen liquor jugs",
+		"How vexingly quick daft zebras jump",
+		"The five boxing wizards jump quickly",
+		"Sphinx of black quartz, judge my vow",
+		"A quick movement of the enemy will jeopardize six gunboats",
+		"Jackdaws love my big sphinx of quartz",
+	}
+	docs := make([]*Document, 200)
+	for i := range docs {
+		docs[i] = &Document{ID: i, Title: fmt.Sprintf("Document %d", i%13), Text: texts[i%len(texts)]}
+	}
+
+	opts := []IndexOption{WithField(FieldTitle, NewEnglishAnalyzer())}
+	idx := NewIndex(opts...)
+	idx.Add(docs)
+	sharded := NewShardedIndex(4, opts...)
+	sharded.Add(docs[:50])
+	sharded.Add(docs[50:])
+
+	assert.Equal(t, idx.Stats().DocumentCount, sharded.Stats().DocumentCount)
+	assert.Equal(t, idx.Stats().TermCount, sharded.Stats().TermCount)
+	assert.Equal(t, idx.SurfaceForms(), sharded.SurfaceForms())
+
+	scores := func(results []SearchResult) map[int]float32 {
+		m := make(map[int]float32, len(results))
+		for _, result := range results {
+			m[result.DocID] = result.Score
+		}
+		return m
+	}
+
+	// Scores are those of a single index, using the document frequencies of all shards
+	for _, query := range []string{"quick jump", "qu*", "quartz~1", `"quick brown"`, "sphinx title:document", "five title:3"} {
+		results := idx.Search(query)
+		assert.NotEmpty(t, results, query)
+		assert.Equal(t, scores(results), scores(sharded.Search(query)), query)
+
+		resp, err := sharded.SearchContext(context.Background(), query, SearchOptions{Limit: 5})
+		assert.NoError(t, err)
+		if assert.Len(t, resp.Results, min(5, len(results)), query) {
+			assert.Equal(t, results[0].Score, resp.Results[0].Score, query)
+		}
+
+		e, err := sharded.Explain(query, results[0].DocID)
+		assert.NoError(t, err)
+		assert.Equal(t, results[0].Score, e.Value, query)
+	}
+
+	want, err := idx.MoreLikeThis(1, MoreLikeThisOptions{})
+	assert.NoError(t, err)
+	got, err := sharded.MoreLikeThis(1, MoreLikeThisOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, scores(want), scores(got))
+
+	_, err = sharded.Explain("quick", 1000)
+	assert.ErrorIs(t, err, ErrDocumentNotFound)
+
+	sharded.Clear()
+	assert.Empty(t, sharded.Search("quick"))
+	assert.Zero(t, sharded.Stats().DocumentCount)
+}
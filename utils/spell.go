@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// SpellChecker proposes corrections for query terms that do not occur in the index.
+// It is built from the unstemmed surface forms seen during indexing, so suggestions
+// are real words rather than stems.
+type SpellChecker struct {
+	dict     *termDict
+	freqs    map[string]int
+	analyzer Analyzer
+}
+
+// Suggestion is a candidate correction for a misspelled term.
+type Suggestion struct {
+	Term     string
+	Distance int // Edit distance from the original term
+	DocFreq  int // Number of documents containing the suggested term
+}
+
+// NewSpellChecker creates a SpellChecker from surface forms and their document
+// frequencies, as returned by Indexer.SurfaceForms, and the analyzer that produced them.
+func NewSpellChecker(vocabulary map[string]int, analyzer Analyzer) *SpellChecker {
+	terms := make([]string, 0, len(vocabulary))
+	for term := range vocabulary {
+		terms = append(terms, term)
+	}
+	return &SpellChecker{
+		dict:     newTermDict(terms),
+		freqs:    vocabulary,
+		analyzer: analyzer,
+	}
+}
+
+// maxSuggestDistance returns the edit distance allowed when correcting word.
+// Short words tolerate a single edit, longer ones two.
+func maxSuggestDistance(word string) int {
+	if utf8.RuneCountInString(word) <= 4 {
+		return 1
+	}
+	return 2
+}
+
+// Suggest returns up to n corrections for word, closest first and, for equal
+// distances, most frequent first. Words present in the vocabulary have no suggestions.
+func (sc *SpellChecker) Suggest(word string, n int) []Suggestion {
+	word = strings.ToLower(word)
+	if form, ok := querySurface(sc.analyzer, word); ok {
+		// Compare surface forms, e.g. with accents folded
+		word = form
+	}
+	if _, ok := sc.freqs[word]; ok || n <= 0 {
+		return nil
+	}
+
+	matches, _ := sc.dict.fuzzy(context.Background(), word, maxSuggestDistance(word))
+	suggestions := make([]Suggestion, 0, len(matches))
+	for _, match := range matches {
+		suggestions = append(suggestions, Suggestion{
+			Term:     match.Term,
+			Distance: match.Distance,
+			DocFreq:  sc.freqs[match.Term],
+		})
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		if a.DocFreq != b.DocFreq {
+			return a.DocFreq > b.DocFreq
+		}
+		return a.Term < b.Term
+	})
+
+	if len(suggestions) > n {
+		suggestions = suggestions[:n]
+	}
+	return suggestions
+}
+
+// CorrectQuery replaces every unknown word of the text and phrase clauses of query
+// with its best suggestion, leaving the rest of the query untouched: field names,
+// fuzzy, prefix, wildcard and range clauses. It returns the corrected query and
+// whether any word was changed.
+func (sc *SpellChecker) CorrectQuery(query string) (string, bool) {
+	var b strings.Builder
+	changed := false
+	last := 0 // end of the query copied to b
+	parts := queryParts(query)
+	for i := 0; i < len(parts); i++ {
+		start, end := parts[i][0], parts[i][1]
+		_, text := splitField(query[start:end])
+
+		// Ranges span three parts, see parseQuery
+		if i+2 < len(parts) {
+			to, upper := query[parts[i+1][0]:parts[i+1][1]], query[parts[i+2][0]:parts[i+2][1]]
+			if _, ok := parseRange(text, to, upper); ok {
+				i += 2
+				continue
+			}
+		}
+		if kind := parseClause(text).kind; kind != textClause && kind != phraseClause {
+			continue
+		}
+
+		corrected, ok := sc.correctWords(text)
+		if !ok {
+			continue
+		}
+		b.WriteString(query[last : end-len(text)])
+		b.WriteString(corrected)
+		last, changed = end, true
+	}
+	b.WriteString(query[last:])
+	return b.String(), changed
+}
+
+// correctWords replaces every unknown word of text with its best suggestion,
+// leaving anything else untouched.
+func (sc *SpellChecker) correctWords(text string) (string, bool) {
+	var b strings.Builder
+	changed := false
+	for len(text) > 0 {
+		// Copy everything up to the next word as is
+		start := strings.IndexFunc(text, isWordRune)
+		if start < 0 {
+			b.WriteString(text)
+			break
+		}
+		b.WriteString(text[:start])
+		text = text[start:]
+
+		end := strings.IndexFunc(text, func(r rune) bool { return !isWordRune(r) })
+		if end < 0 {
+			end = len(text)
+		}
+		word := text[:end]
+		text = text[end:]
+
+		if sc.shouldCorrect(word) {
+			if suggestions := sc.Suggest(word, 1); len(suggestions) > 0 {
+				b.WriteString(suggestions[0].Term)
+				changed = true
+				continue
+			}
+		}
+		b.WriteString(word)
+	}
+	return b.String(), changed
+}
+
+// shouldCorrect reports whether word is a candidate for correction.
+// Stopwords and very short words are never indexed, so they are left alone.
+func (sc *SpellChecker) shouldCorrect(word string) bool {
+	return len(surfaceForms(sc.analyzer, word)) == 1 && utf8.RuneCountInString(word) > 2
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpellChecker(t *testing.T) {
+	idx := NewIndex()
+	idx.Add([]*Document{
+		{ID: 0, Text: "Albert Einstein developed the theory of relativity."},
+		{ID: 1, Text: "Einstein received the Nobel Prize in physics."},
+		{ID: 2, Text: "Einsteinium is named after Einstein."},
+		{ID: 3, Text: "Relativity changed physics forever."},
+	})
+
+	// Suggestions are built from unstemmed surface forms
+	forms := idx.SurfaceForms()
+	assert.Equal(t, 3, forms["einstein"])
+	assert.Equal(t, 1, forms["developed"])
+	assert.NotContains(t, forms, "develop")
+
+	sc := NewSpellChecker(forms, idx.Analyzer())
+
+	suggestions := sc.Suggest("einstien", 3)
+	assert.Equal(t, []Suggestion{{Term: "einstein", Distance: 1, DocFreq: 3}}, suggestions)
+
+	// Known words have no suggestions
+	assert.Empty(t, sc.Suggest("Einstein", 3))
+
+	corrected, changed := sc.CorrectQuery("Einstien's theory of relativty")
+	assert.True(t, changed)
+	assert.Equal(t, "einstein's theory of relativity", corrected)
+
+	corrected, changed = sc.CorrectQuery("nobel physics")
+	assert.False(t, changed)
+	assert.Equal(t, "nobel physics", corrected)
+}
+
+func TestCorrectQuerySyntax(t *testing.T) {
+	idx := NewIndex(WithField(FieldTitle, NewEnglishAnalyzer()))
+	idx.Add([]*Document{
+		{ID: 0, Title: "Albert Einstein", Text: "Albert Einstein developed the theory of relativity."},
+		{ID: 1, Title: "Physics", Text: "Einstein received the Nobel Prize in physics."},
+	})
+	sc := NewSpellChecker(idx.SurfaceForms(), idx.Analyzer())
+
+	// Only the text of text and phrase clauses is corrected
+	for query, want := range map[string]string{
+		"title:einstien":               "title:einstein",
+		`"theory of relativty"  nobel`: `"theory of relativity"  nobel`,
+		"[albrt TO einstien] physcs":   "[albrt TO einstien] physics",
+		"einstien~1 relat* th?ory":     "einstien~1 relat* th?ory",
+	} {
+		corrected, changed := sc.CorrectQuery(query)
+		assert.Equal(t, want, corrected, query)
+		assert.Equal(t, want != query, changed, query)
+	}
+}
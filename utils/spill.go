@@ -0,0 +1,291 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// Estimated memory held by the postings of an Index, see WithMemoryBudget.
+const (
+	entryBytes   = 64*(8+4) + 96 // new entry with its preallocated slices and map slot
+	postingBytes = 8 + 4 + 4     // document ID, frequency and end offset of its positions
+)
+
+// spillStore holds the postings an Index with a memory budget has written to disk.
+// Postings exceeding the budget are spilled to sorted runs, which are merged with
+// the previous postings file into a new one at the end of Add.
+type spillStore struct {
+	dir    string
+	budget int64
+	runs   []string // runs spilled by the current Add, in order
+	path   string   // merged postings file, empty before the first merge
+	file   *os.File
+	terms  map[string]diskTerm
+	spills int
+}
+
+// diskTerm locates the postings of a term in the postings file.
+type diskTerm struct {
+	offset, size int64
+	df           int
+}
+
+func newSpillStore(budget int64, dir string) *spillStore {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return &spillStore{dir: dir, budget: budget, terms: make(map[string]diskTerm)}
+}
+
+// spill writes entries to a new run sorted by term.
+func (s *spillStore) spill(entries map[string]*IndexEntry) error {
+	terms := make([]string, 0, len(entries))
+	for term := range entries {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	f, err := os.CreateTemp(s.dir, "index-run-*")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f.Name())
+	w := bufio.NewWriter(f)
+	var buf []byte
+	for _, term := range terms {
+		buf = encodePostings(buf[:0], term, *entries[term])
+		if _, err := w.Write(buf); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	s.spills++
+	return f.Close()
+}
+
+// merge merges the postings file and the runs into a new postings file, concatenating
+// the postings of each term in the order they were added, and removes the inputs.
+func (s *spillStore) merge() error {
+	paths := s.runs
+	if s.path != "" {
+		paths = append([]string{s.path}, paths...)
+	}
+
+	h := make(runHeap, 0, len(paths))
+	for i, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			h.close()
+			return err
+		}
+		r := &runReader{f: f, r: bufio.NewReader(f), order: i}
+		if err := r.next(); err != nil {
+			f.Close()
+			if err == io.EOF {
+				continue
+			}
+			h.close()
+			return err
+		}
+		h = append(h, r)
+	}
+	defer func() { h.close() }()
+	heap.Init(&h)
+
+	out, err := os.CreateTemp(s.dir, "index-postings-*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	terms := make(map[string]diskTerm, len(s.terms))
+	var offset int64
+	var buf []byte
+	for len(h) > 0 {
+		// Runs holding the same term come out in order, oldest first
+		term := h[0].term
+		var entry IndexEntry
+		for len(h) > 0 && h[0].term == term {
+			entry = appendEntry(entry, h[0].entry)
+			if err = h[0].next(); err == io.EOF {
+				heap.Pop(&h).(*runReader).f.Close()
+			} else if err != nil {
+				break
+			} else {
+				heap.Fix(&h, 0)
+			}
+		}
+		if err != nil && err != io.EOF {
+			break
+		}
+		buf = encodePostings(buf[:0], term, entry)
+		if _, err = w.Write(buf); err != nil {
+			break
+		}
+		terms[term] = diskTerm{offset: offset, size: int64(len(buf)), df: len(entry.DocIDs)}
+		offset += int64(len(buf))
+	}
+	if err == nil || err == io.EOF {
+		err = w.Flush()
+	}
+	if err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	for _, path := range paths {
+		os.Remove(path)
+	}
+	s.path, s.file, s.terms, s.runs = out.Name(), out, terms, nil
+	return nil
+}
+
+// lookup reads the postings of term from the postings file. Postings that cannot
+// be read are reported missing.
+func (s *spillStore) lookup(term string) (IndexEntry, bool) {
+	t, ok := s.terms[term]
+	if !ok {
+		return IndexEntry{}, false
+	}
+	buf := make([]byte, t.size)
+	if _, err := s.file.ReadAt(buf, t.offset); err != nil {
+		return IndexEntry{}, false
+	}
+	_, entry, err := decodePostings(bytes.NewReader(buf))
+	return entry, err == nil
+}
+
+// close removes the files of the store and forgets their postings.
+func (s *spillStore) close() error {
+	var errs []error
+	if s.file != nil {
+		errs = append(errs, s.file.Close())
+	}
+	if s.path != "" {
+		errs = append(errs, os.Remove(s.path))
+	}
+	for _, path := range s.runs {
+		errs = append(errs, os.Remove(path))
+	}
+	s.path, s.file, s.terms, s.runs, s.spills = "", nil, make(map[string]diskTerm), nil, 0
+	return errors.Join(errs...)
+}
+
+// encodePostings appends the term and its postings to buf. Positions are delta encoded.
+func encodePostings(buf []byte, term string, entry IndexEntry) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(term)))
+	buf = append(buf, term...)
+	buf = binary.AppendUvarint(buf, uint64(len(entry.DocIDs)))
+	for i, docID := range entry.DocIDs {
+		buf = binary.AppendVarint(buf, int64(docID))
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(entry.Freqs[i]))
+		positions := entry.Positions.bytes(i)
+		buf = binary.AppendUvarint(buf, uint64(len(positions)))
+		buf = append(buf, positions...)
+	}
+	return buf
+}
+
+// postingsReader is read by decodePostings.
+type postingsReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// decodePostings reads a term and its postings written by encodePostings.
+func decodePostings(r postingsReader) (string, IndexEntry, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", IndexEntry{}, err
+	}
+	term := make([]byte, n)
+	if _, err := io.ReadFull(r, term); err != nil {
+		return "", IndexEntry{}, err
+	}
+	if n, err = binary.ReadUvarint(r); err != nil {
+		return "", IndexEntry{}, err
+	}
+	entry := IndexEntry{
+		DocIDs: make([]int, n),
+		Freqs:  make([]float32, n),
+	}
+	var freq [4]byte
+	var positions []byte
+	for i := range entry.DocIDs {
+		docID, err := binary.ReadVarint(r)
+		if err != nil {
+			return "", IndexEntry{}, err
+		}
+		if _, err := io.ReadFull(r, freq[:]); err != nil {
+			return "", IndexEntry{}, err
+		}
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return "", IndexEntry{}, err
+		}
+		positions = append(positions[:0], make([]byte, size)...)
+		if _, err := io.ReadFull(r, positions); err != nil {
+			return "", IndexEntry{}, err
+		}
+		entry.DocIDs[i] = int(docID)
+		entry.Freqs[i] = math.Float32frombits(binary.LittleEndian.Uint32(freq[:]))
+		entry.Positions.addEncoded(positions)
+	}
+	return string(term), entry, nil
+}
+
+// runReader reads the terms of a run or postings file in order.
+type runReader struct {
+	f     *os.File
+	r     *bufio.Reader
+	order int // position of the file among the merged ones
+	term  string
+	entry IndexEntry
+}
+
+// next reads the next term, returning io.EOF after the last one.
+func (r *runReader) next() (err error) {
+	r.term, r.entry, err = decodePostings(r.r)
+	return err
+}
+
+// runHeap orders run readers by their current term, then by their order.
+type runHeap []*runReader
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	if h[i].term != h[j].term {
+		return h[i].term < h[j].term
+	}
+	return h[i].order < h[j].order
+}
+func (h runHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)   { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// close closes the files of the readers left in the heap.
+func (h runHeap) close() {
+	for _, r := range h {
+		r.f.Close()
+	}
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	docs := generateLargeDataset(2000)
+	dir := t.TempDir()
+	const budget = 32 << 10
+
+	opts := []IndexOption{WithField(FieldTitle, NewEnglishAnalyzer())}
+	idx := NewIndex(opts...)
+	idx.Add(docs)
+	spilled := NewIndex(append(opts, WithMemoryBudget(budget, dir))...)
+	for i := 0; i < len(docs); i += 500 {
+		assert.NoError(t, spilled.AddContext(context.Background(), docs[i:i+500]))
+	}
+
+	// Postings are searched from disk, with the same results
+	stats := spilled.Stats()
+	assert.Greater(t, stats.Spills, 4)
+	assert.LessOrEqual(t, stats.PeakMemoryBytes, int64(budget+entryBytes*10))
+	assert.Greater(t, idx.Stats().PeakMemoryBytes, int64(budget))
+	assert.Equal(t, idx.Stats().TermCount, stats.TermCount)
+	assert.Empty(t, spilled.entries)
+
+	for _, query := range []string{"quick jump", "qu*", `"quick brown fox"`, "title:document"} {
+		results := idx.Search(query)
+		assert.NotEmpty(t, results, query)
+		assert.ElementsMatch(t, results, spilled.Search(query), query)
+	}
+
+	// Postings added without spilling are searched along with those on disk
+	more := []*Document{{ID: 2000, Text: "The quick brown fox"}}
+	idx.Add(more)
+	spilled.Add(more)
+	assert.ElementsMatch(t, idx.Search("fox"), spilled.Search("fox"))
+
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2, "one postings file per field")
+	assert.NoError(t, spilled.Close())
+	files, err = os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
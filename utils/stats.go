@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"math"
+	"sort"
+)
+
+// TermStats contains statistics about an index term
+type TermStats struct {
+	Term         string
+	DocFreq      int   // Number of documents containing the term
+	TotalFreq    int   // Number of occurrences of the term in all documents
+	PostingBytes int64 // Approximate size of the posting list in bytes
+}
+
+// indexStats computes the statistics of src from the postings of terms, its
+// vocabulary, and the number of index terms of its documents.
+func indexStats(src termSource, terms []string, tokenCount int64) IndexStats {
+	docCount := src.numDocs()
+	stats := IndexStats{DocumentCount: docCount}
+	if docCount > 0 {
+		stats.AvgDocLength = float64(tokenCount) / float64(docCount)
+	}
+
+	// Scores are those of single terms in each document, TF * IDF
+	var size int64
+	minScore, maxScore := math.Inf(1), math.Inf(-1)
+	for _, term := range terms {
+		entry, ok := src.lookup(term)
+		if !ok {
+			continue
+		}
+		size += int64(len(term)) + postingListBytes(entry)
+		df := src.docFreq(term)
+		if df <= 0 {
+			continue // only in replaced documents
+		}
+		stats.TermCount++
+		idf := inverseDocFreq(docCount, df)
+		for i, tf := range entry.Freqs {
+			if !src.live(entry.DocIDs[i]) {
+				continue
+			}
+			score := float64(tf * idf)
+			minScore, maxScore = min(minScore, score), max(maxScore, score)
+		}
+	}
+	if !math.IsInf(maxScore, -1) {
+		stats.MinScore, stats.MaxScore = minScore, maxScore
+	}
+	stats.IndexSizeKB = (size + 1023) / 1024
+	return stats
+}
+
+// postingListBytes returns the approximate size of the postings of entry in memory.
+func postingListBytes(entry IndexEntry) int64 {
+	size := int64(4 * 24) // slice headers
+	return size + postingBytes*int64(len(entry.DocIDs)) + int64(len(entry.Positions.data))
+}
+
+// termStats returns the statistics of term in src, if it is indexed in documents
+// that were not replaced.
+func termStats(src termSource, term string) (TermStats, bool) {
+	entry, ok := src.lookup(term)
+	if !ok {
+		return TermStats{}, false
+	}
+	stats := TermStats{
+		Term:         term,
+		DocFreq:      src.docFreq(term),
+		PostingBytes: postingListBytes(entry),
+	}
+	if stats.DocFreq <= 0 {
+		return TermStats{}, false // only in replaced documents
+	}
+	for i, docID := range entry.DocIDs {
+		if src.live(docID) {
+			stats.TotalFreq += entry.Positions.Count(i)
+		}
+	}
+	return stats, true
+}
+
+// topTerms returns the statistics of the n terms of src occurring most often, most
+// frequent first, ties broken by document frequency then alphabetically.
+func topTerms(src termSource, terms []string, n int) []TermStats {
+	all := make([]TermStats, 0, len(terms))
+	for _, term := range terms {
+		if stats, ok := termStats(src, term); ok {
+			all = append(all, stats)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].TotalFreq != all[j].TotalFreq {
+			return all[i].TotalFreq > all[j].TotalFreq
+		}
+		if all[i].DocFreq != all[j].DocFreq {
+			return all[i].DocFreq > all[j].DocFreq
+		}
+		return all[i].Term < all[j].Term
+	})
+	if n < len(all) {
+		all = all[:max(n, 0)]
+	}
+	return all
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	docs := []*Document{
+		{ID: 0, Text: "quick brown fox"},
+		{ID: 1, Text: "quick dog"},
+		{ID: 2, Text: "brown dog dog"},
+	}
+
+	for name, idx := range map[string]Indexer{
+		"Index":           NewIndex(),
+		"ConcurrentIndex": NewConcurrentIndex(),
+		"ShardedIndex":    NewShardedIndex(2),
+	} {
+		idx.Add(docs[:1])
+		idx.Add(docs[1:])
+
+		stats := idx.Stats()
+		assert.Equal(t, 3, stats.DocumentCount, name)
+		assert.Equal(t, 4, stats.TermCount, name)
+		assert.InDelta(t, 8.0/3, stats.AvgDocLength, 1e-9, name)
+		// brown and quick in the first document, and dog twice in the last one, all with an IDF of 1
+		assert.InDelta(t, 1.0/3, stats.MinScore, 1e-6, name)
+		assert.InDelta(t, 2.0/3, stats.MaxScore, 1e-6, name)
+		assert.Equal(t, int64(1), stats.IndexSizeKB, name)
+
+		dog, ok := idx.TermStats("dog")
+		assert.True(t, ok, name)
+		assert.Equal(t, TermStats{Term: "dog", DocFreq: 2, TotalFreq: 3, PostingBytes: 4*24 + 2*postingBytes + 3}, dog, name)
+		_, ok = idx.TermStats("cat")
+		assert.False(t, ok, name)
+
+		top := idx.TopTerms(3)
+		if assert.Len(t, top, 3, name) {
+			assert.Equal(t, []string{"dog", "brown", "quick"}, []string{top[0].Term, top[1].Term, top[2].Term}, name)
+		}
+		assert.Len(t, idx.TopTerms(10), 4, name)
+
+		// Statistics are computed again once documents are added
+		counter, ok := idx.(DocumentCounter)
+		assert.True(t, ok, name)
+		assert.Equal(t, 3, counter.DocumentCount(), name)
+		idx.Add([]*Document{{ID: 3, Text: "quick cat"}})
+		assert.Equal(t, 4, counter.DocumentCount(), name)
+		assert.Equal(t, 4, idx.Stats().DocumentCount, name)
+		assert.Equal(t, 5, idx.Stats().TermCount, name)
+
+		idx.Clear()
+		assert.Equal(t, 0, counter.DocumentCount(), name)
+		assert.Equal(t, IndexStats{}, idx.Stats(), name)
+	}
+}
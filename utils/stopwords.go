@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// StopwordSet reports whether words are stop words.
+type StopwordSet interface {
+	Contains(word string) bool
+}
+
+// Stopwords is a StopwordSet listing its words.
+type Stopwords map[string]bool
+
+// NewStopwords returns a set of the given words, lower-cased.
+func NewStopwords(words ...string) Stopwords {
+	s := make(Stopwords, len(words))
+	for _, word := range words {
+		s[strings.ToLower(word)] = true
+	}
+	return s
+}
+
+// LoadStopwords reads a stopword list from a file, see ParseStopwords.
+func LoadStopwords(path string) (Stopwords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseStopwords(f)
+}
+
+// ParseStopwords reads a stopword list: whitespace-separated words, usually one per
+// line. Everything following '#' or '|' on a line is a comment, so both the usual
+// format and the Snowball stopword lists are accepted.
+func ParseStopwords(r io.Reader) (Stopwords, error) {
+	s := make(Stopwords)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#|"); i >= 0 {
+			line = line[:i]
+		}
+		for _, word := range strings.Fields(line) {
+			s[strings.ToLower(word)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Contains reports whether word is in the set.
+func (s Stopwords) Contains(word string) bool {
+	return s[word]
+}
+
+// stopwordFunc adapts a predicate, such as a Snowball IsStopWord function, to StopwordSet.
+type stopwordFunc func(word string) bool
+
+func (f stopwordFunc) Contains(word string) bool {
+	return f(word)
+}
+
+// NewStopwordFilter returns a filter removing the words of s.
+func NewStopwordFilter(s StopwordSet) TokenFilter {
+	return NamedFilter("stopwords", TokenFilterFunc(func(tokens []Token) []Token {
+		return keepTokens(tokens, func(token Token) bool {
+			return !s.Contains(token.Term)
+		})
+	}))
+}
+
+// lowercaseStopwordFilter returns a filter removing the words of s ignoring case,
+// leaving the case of the other words alone.
+func lowercaseStopwordFilter(s StopwordSet) TokenFilter {
+	return NamedFilter("stopwords", TokenFilterFunc(func(tokens []Token) []Token {
+		return keepTokens(tokens, func(token Token) bool {
+			return !s.Contains(strings.ToLower(token.Term))
+		})
+	}))
+}
+
+// commonGramSeparator joins the words of a common gram, see WithCommonGrams.
+const commonGramSeparator = "_"
+
+// commonGrams returns the common grams of tokens, given their surface forms: for
+// each pair of adjacent tokens of which at least one is common, a token joining their
+// terms at the position of the first one. Surface forms are paired with tokens by
+// position, so no grams are made when normalizing changed the number of tokens, as
+// n-gram filters do.
+func commonGrams(common StopwordSet, surface, tokens []Token) []Token {
+	if len(surface) != len(tokens) {
+		return nil
+	}
+	var grams []Token
+	for i := 0; i+1 < len(tokens); i++ {
+		first, second := tokens[i], tokens[i+1]
+		if second.Position != first.Position+1 || surface[i].Position != first.Position || surface[i+1].Position != second.Position {
+			continue
+		}
+		if common.Contains(surface[i].Term) || common.Contains(surface[i+1].Term) {
+			grams = append(grams, Token{
+				Term:     first.Term + commonGramSeparator + second.Term,
+				Start:    first.Start,
+				End:      second.End,
+				Position: first.Position,
+			})
+		}
+	}
+	return grams
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStopwords(t *testing.T) {
+	s, err := ParseStopwords(strings.NewReader("# Articles\nThe\na an | Snowball comment\n\nof"))
+	assert.NoError(t, err)
+	assert.Equal(t, NewStopwords("the", "a", "an", "of"), s)
+	assert.True(t, s.Contains("an"))
+	assert.False(t, s.Contains("snowball"))
+
+	filtered := NewStopwordFilter(s).Filter(newTokens([]string{"the", "cat", "of", "a", "hat"}))
+	assert.Equal(t, []string{"cat", "hat"}, tokenTerms(filtered))
+	assert.Equal(t, []int{2, 3}, []int{filtered[0].PositionIncrement, filtered[1].PositionIncrement})
+
+	french, err := LanguageStopwords(French)
+	assert.NoError(t, err)
+	assert.True(t, french.Contains("leur"))
+	_, err = LanguageStopwords("xx")
+	assert.ErrorIs(t, err, ErrUnsupportedLanguage)
+}
+
+func TestCommonGrams(t *testing.T) {
+	common := NewStopwords("the", "of")
+	grams := commonGrams(common, newTokens([]string{"the", "theory", "of", "relativity"}), newTokens([]string{"the", "theori", "of", "relat"}))
+	assert.Equal(t, []string{"the_theori", "theori_of", "of_relat"}, tokenTerms(grams))
+	assert.Equal(t, []int{0, 1, 2}, []int{grams[0].Position, grams[1].Position, grams[2].Position})
+
+	wt := commonGramPhrase(common, newTokens([]string{"the", "big", "bang", "theory"}), newTokens([]string{"the", "big", "bang", "theori"}))
+	assert.Equal(t, []string{"the_big", "bang", "theori"}, wt.phrase)
+	assert.Equal(t, []int{0, 2, 3}, wt.offset)
+
+	// No grams for fields whose analyzer changes the number of tokens
+	edge := NewEdgeNGramAnalyzer(2, 15)
+	surface := analyzeSurface(edge, "the fox")
+	assert.Empty(t, commonGrams(common, surface, normalize(edge, surface)))
+	titles := NewAnalyzerBuilder(StandardTokenizer).Filter(CharacterFilter, LowercaseFilter).Build()
+	idx := NewIndex(WithAnalyzedField("title_prefix", FieldTitle, edge, titles), WithCommonGrams(common))
+	assert.NotPanics(t, func() { idx.Add([]*Document{{ID: 1, Title: "The quick fox", Text: "The quick fox"}}) })
+	assert.Len(t, idx.Search("title_prefix:qui"), 1)
+	assert.Len(t, idx.Search(`title_prefix:"the quick"`), 1)
+	assert.Len(t, idx.Search(`"the quick"`), 1)
+}
+
+func TestKeptStopwords(t *testing.T) {
+	english, err := LanguageStopwords(English)
+	assert.NoError(t, err)
+	analyzer, err := NewLanguageAnalyzerWithStopwords(English, nil)
+	assert.NoError(t, err)
+	docs := []*Document{
+		{ID: 1, Text: "The Who are an English rock band"},
+		{ID: 2, Text: "Who wrote the songs of the band?"},
+		{ID: 3, Text: "To be, or not to be, that is the question"},
+	}
+
+	// Stop words are removed by default
+	plain := NewIndex()
+	plain.Add(docs)
+	assert.Empty(t, plain.Search("the who"))
+
+	opts := []IndexOption{WithAnalyzer(analyzer), WithKeptStopwords(english)}
+	for _, idx := range []Indexer{
+		NewIndex(opts...),
+		NewConcurrentIndex(opts...),
+		NewIndex(append(opts, WithCommonGrams(english))...),
+		NewConcurrentIndex(append(opts, WithCommonGrams(english))...),
+	} {
+		idx.Add(docs)
+
+		results := idx.Search(`"the who"`)
+		assert.Len(t, results, 1)
+		assert.Equal(t, 1, results[0].DocID)
+
+		results = idx.Search(`"to be or not to be"`)
+		assert.Len(t, results, 1)
+		assert.Equal(t, 3, results[0].DocID)
+		assert.Empty(t, idx.Search(`"to be or to be"`))
+
+		// Queries made only of stop words use them
+		assert.ElementsMatch(t, []int{1, 2, 3}, docIDs(idx.Search("the who")))
+
+		// Otherwise stop words are ignored
+		assert.Equal(t, idx.Search("rock band"), idx.Search("the rock of the band"))
+	}
+}
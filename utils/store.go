@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// storeBlockSize is the size of the records compressed together by a docStore.
+// Larger blocks compress better but cost more to decompress for a single document.
+const storeBlockSize = 16 << 10
+
+// docStore holds the stored fields of indexed documents. Records are appended to a
+// pending block, compressed with DEFLATE once it reaches storeBlockSize, so that
+// documents take a fraction of the memory of their text.
+type docStore struct {
+	blocks  [][]byte       // compressed blocks of records
+	locs    map[int]docLoc // document ID -> location of its record
+	pending []byte         // records of the block being filled, uncompressed
+}
+
+// docLoc locates a record in the uncompressed content of a block. The block
+// len(blocks) is the pending one.
+type docLoc struct {
+	block, offset int
+}
+
+func newDocStore() *docStore {
+	return &docStore{locs: make(map[int]docLoc)}
+}
+
+// add stores doc, replacing any document with the same ID.
+func (st *docStore) add(doc *Document) error {
+	st.locs[doc.ID] = docLoc{block: len(st.blocks), offset: len(st.pending)}
+	st.pending = encodeDocument(st.pending, doc)
+	if len(st.pending) >= storeBlockSize {
+		return st.flush()
+	}
+	return nil
+}
+
+// flush compresses the pending block, if any.
+func (st *docStore) flush() error {
+	if len(st.pending) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(st.pending); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	st.blocks = append(st.blocks, buf.Bytes())
+	st.pending = st.pending[:0]
+	return nil
+}
+
+// has reports whether the document docID is stored.
+func (st *docStore) has(docID int) bool {
+	_, ok := st.locs[docID]
+	return ok
+}
+
+// fill sets the nil documents of docs to the stored documents of the same
+// index in ids, decompressing each block once.
+func (st *docStore) fill(ids []int, docs []*Document) error {
+	var found []int // indexes of ids found in the store
+	for i, id := range ids {
+		if docs[i] != nil {
+			continue
+		}
+		if _, ok := st.locs[id]; ok {
+			found = append(found, i)
+		}
+	}
+	sort.Slice(found, func(a, b int) bool {
+		return st.locs[ids[found[a]]].block < st.locs[ids[found[b]]].block
+	})
+
+	block, data := -1, []byte(nil)
+	for _, i := range found {
+		loc := st.locs[ids[i]]
+		if loc.block != block {
+			var err error
+			if data, err = st.block(loc.block); err != nil {
+				return err
+			}
+			block = loc.block
+		}
+		doc, err := decodeDocument(data[loc.offset:])
+		if err != nil {
+			return fmt.Errorf("document %d: %w", ids[i], err)
+		}
+		doc.ID = ids[i]
+		docs[i] = doc
+	}
+	return nil
+}
+
+// block returns the uncompressed records of block i.
+func (st *docStore) block(i int) ([]byte, error) {
+	if i == len(st.blocks) {
+		return st.pending, nil
+	}
+	r := flate.NewReader(bytes.NewReader(st.blocks[i]))
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// mergeStores returns a store with the documents of all stores, those of later
+// stores replacing documents with the same ID. The stores must be flushed, and
+// their blocks are shared rather than copied.
+func mergeStores(stores []*docStore) *docStore {
+	merged := newDocStore()
+	for _, st := range stores {
+		base := len(merged.blocks)
+		merged.blocks = append(merged.blocks, st.blocks...)
+		for id, loc := range st.locs {
+			merged.locs[id] = docLoc{block: base + loc.block, offset: loc.offset}
+		}
+	}
+	return merged
+}
+
+// encodeDocument appends the stored fields of doc to buf.
+func encodeDocument(buf []byte, doc *Document) []byte {
+	for _, field := range []string{doc.Title, doc.URL, doc.Text, string(doc.Lang), doc.Key} {
+		buf = binary.AppendUvarint(buf, uint64(len(field)))
+		buf = append(buf, field...)
+	}
+	return buf
+}
+
+// errCorruptRecord is returned for stored records that cannot be decoded.
+var errCorruptRecord = errors.New("corrupt stored record")
+
+// decodeDocument reads a document written by encodeDocument at the start of data.
+func decodeDocument(data []byte) (*Document, error) {
+	var fields [5]string
+	for i := range fields {
+		n, size := binary.Uvarint(data)
+		if size <= 0 || uint64(len(data)-size) < n {
+			return nil, errCorruptRecord
+		}
+		fields[i] = string(data[size : size+int(n)])
+		data = data[size+int(n):]
+	}
+	return &Document{Title: fields[0], URL: fields[1], Text: fields[2], Lang: Language(fields[3]), Key: fields[4]}, nil
+}
+
+// documents returns the documents ids from the stores, searched in order, or
+// ErrDocumentNotFound if one of them is in none of the stores or replaced.
+func documents(ids []int, replaced map[int]struct{}, stores ...*docStore) ([]*Document, error) {
+	for _, id := range ids {
+		if _, ok := replaced[id]; ok {
+			return nil, fmt.Errorf("%w: %d", ErrDocumentNotFound, id)
+		}
+	}
+	docs := make([]*Document, len(ids))
+	for _, st := range stores {
+		if err := st.fill(ids, docs); err != nil {
+			return nil, err
+		}
+	}
+	for i, doc := range docs {
+		if doc == nil {
+			return nil, fmt.Errorf("%w: %d", ErrDocumentNotFound, ids[i])
+		}
+	}
+	return docs, nil
+}
+
+// storedIDs returns the IDs of the documents in the stores that are not
+// replaced, in increasing order.
+func storedIDs(replaced map[int]struct{}, stores ...*docStore) []int {
+	seen := make(map[int]struct{})
+	var ids []int
+	for _, st := range stores {
+		for id := range st.locs {
+			if _, ok := replaced[id]; ok {
+				continue
+			}
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
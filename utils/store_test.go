@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocumentStore(t *testing.T) {
+	docs := generateLargeDataset(3000)
+	docs[7].URL = "https://en.wikipedia.org/wiki/Fox"
+	docs[7].Lang = French
+
+	for name, idx := range map[string]Indexer{
+		"Index":           NewIndex(),
+		"ConcurrentIndex": NewConcurrentIndex(),
+		"ShardedIndex":    NewShardedIndex(3),
+	} {
+		idx.Add(docs[:1000])
+		idx.Add(docs[1000:])
+
+		// Documents are copies of those added, read from compressed blocks
+		doc, err := idx.Get(7)
+		assert.NoError(t, err, name)
+		assert.Equal(t, *docs[7], *doc, name)
+		assert.NotSame(t, docs[7], doc, name)
+
+		ids := []int{2999, 0, 1500, 7, 0}
+		got, err := idx.GetMany(ids)
+		assert.NoError(t, err, name)
+		if assert.Len(t, got, len(ids), name) {
+			for i, id := range ids {
+				assert.Equal(t, *docs[id], *got[i], name)
+			}
+		}
+
+		_, err = idx.Get(3000)
+		assert.ErrorIs(t, err, ErrDocumentNotFound, name)
+		_, err = idx.GetMany([]int{1, 3000})
+		assert.ErrorIs(t, err, ErrDocumentNotFound, name)
+
+		idx.Clear()
+		_, err = idx.Get(7)
+		assert.ErrorIs(t, err, ErrDocumentNotFound, name)
+	}
+}
+
+func TestDocumentStoreBlocks(t *testing.T) {
+	st := newDocStore()
+	for _, doc := range generateLargeDataset(2000) {
+		assert.NoError(t, st.add(doc))
+	}
+	assert.Greater(t, len(st.blocks), 1)
+	assert.NotEmpty(t, st.pending)
+
+	// Later documents replace those with the same ID
+	assert.NoError(t, st.add(&Document{ID: 3, Title: "Replaced"}))
+	docs, err := documents([]int{3, 1999}, nil, st)
+	assert.NoError(t, err)
+	assert.Equal(t, "Replaced", docs[0].Title)
+	assert.Equal(t, "Document 1999", docs[1].Title)
+}
@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// SynonymMap holds synonym rules, loaded from a file in the Solr synonyms format:
+//
+//	# Equivalent words and phrases, each one matches all the others
+//	usa, united states, america
+//	# One-way mappings, the words on the left are replaced with those on the right
+//	nyc, big apple => new york
+//
+// Rules are lower-cased and matched against surface forms, so they should not
+// contain words removed by analysis, such as stopwords.
+type SynonymMap struct {
+	rules map[string][]*synonymRule // first word of a rule -> rules starting with it
+}
+
+// synonymRule maps a sequence of words to its synonyms.
+type synonymRule struct {
+	from         []string
+	to           [][]string
+	keepOriginal bool // whether from matches itself, as in equivalent rules
+}
+
+// SynonymMode selects when an index applies synonyms, see WithSynonyms.
+type SynonymMode int
+
+const (
+	// SynonymsAtQuery expands query words with their synonyms. Rules can be changed
+	// without reindexing, and multi-word synonyms are matched as phrases.
+	SynonymsAtQuery SynonymMode = iota
+
+	// SynonymsAtIndex adds synonyms to indexed documents, making queries cheaper.
+	SynonymsAtIndex
+)
+
+// LoadSynonyms reads synonym rules from a file, see SynonymMap.
+func LoadSynonyms(path string) (*SynonymMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseSynonyms(f)
+}
+
+// ParseSynonyms reads synonym rules from r, see SynonymMap.
+func ParseSynonyms(r io.Reader) (*SynonymMap, error) {
+	m := &SynonymMap{rules: make(map[string][]*synonymRule)}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		left, right, oneWay := strings.Cut(text, "=>")
+		from := parseSynonymList(left)
+		if !oneWay {
+			if len(from) < 2 {
+				return nil, fmt.Errorf("synonyms line %d: expected at least two synonyms", line)
+			}
+			for _, words := range from {
+				m.add(words, from, true)
+			}
+			continue
+		}
+
+		to := parseSynonymList(right)
+		if len(from) == 0 || len(to) == 0 {
+			return nil, fmt.Errorf("synonyms line %d: expected synonyms on both sides of =>", line)
+		}
+		for _, words := range from {
+			m.add(words, to, false)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseSynonymList parses a comma-separated list of words or phrases.
+func parseSynonymList(s string) [][]string {
+	var list [][]string
+	for _, item := range strings.Split(s, ",") {
+		if words := strings.Fields(strings.ToLower(item)); len(words) > 0 {
+			list = append(list, words)
+		}
+	}
+	return list
+}
+
+// add maps from to each of to, other than from itself unless keepOriginal is set.
+// Rules for the same words are merged.
+func (m *SynonymMap) add(from []string, to [][]string, keepOriginal bool) {
+	var rule *synonymRule
+	for _, r := range m.rules[from[0]] {
+		if equalWords(r.from, from) {
+			rule = r
+			break
+		}
+	}
+	if rule == nil {
+		rule = &synonymRule{from: from}
+		m.rules[from[0]] = append(m.rules[from[0]], rule)
+	}
+	rule.keepOriginal = rule.keepOriginal || keepOriginal
+
+	for _, words := range to {
+		if equalWords(words, from) {
+			// A one-way rule mapping words to themselves keeps them
+			rule.keepOriginal = true
+			continue
+		}
+		known := false
+		for _, existing := range rule.to {
+			known = known || equalWords(existing, words)
+		}
+		if !known {
+			rule.to = append(rule.to, words)
+		}
+	}
+}
+
+// equalWords reports whether a and b are the same sequence of words.
+func equalWords(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// match returns the longest rule matching tokens at their start, or nil.
+func (m *SynonymMap) match(tokens []string) *synonymRule {
+	if len(tokens) == 0 {
+		return nil
+	}
+	var best *synonymRule
+	for _, rule := range m.rules[tokens[0]] {
+		if len(rule.from) <= len(tokens) && equalWords(rule.from, tokens[:len(rule.from)]) &&
+			(best == nil || len(rule.from) > len(best.from)) {
+			best = rule
+		}
+	}
+	return best
+}
+
+// synonymSlot holds the alternative word sequences for some tokens: a single
+// unmatched token, or the tokens matched by a rule.
+type synonymSlot struct {
+	tokens       []Token // tokens replaced
+	alternatives [][]string
+}
+
+// position returns the position of the first token of the slot.
+func (slot synonymSlot) position() int {
+	return slot.tokens[0].Position
+}
+
+// width returns the number of positions spanned by the tokens of the slot.
+func (slot synonymSlot) width() int {
+	return slot.tokens[len(slot.tokens)-1].Position - slot.position() + 1
+}
+
+// expand splits tokens into slots. A nil map matches no rule.
+func (m *SynonymMap) expand(tokens []Token) []synonymSlot {
+	terms := tokenTerms(tokens)
+	slots := make([]synonymSlot, 0, len(tokens))
+	for i := 0; i < len(tokens); {
+		var rule *synonymRule
+		if m != nil {
+			rule = m.match(terms[i:])
+		}
+		if rule == nil {
+			slots = append(slots, synonymSlot{tokens: tokens[i : i+1], alternatives: [][]string{terms[i : i+1]}})
+			i++
+			continue
+		}
+
+		var alternatives [][]string
+		if rule.keepOriginal {
+			alternatives = append(alternatives, rule.from)
+		}
+		n := len(rule.from)
+		slots = append(slots, synonymSlot{tokens: tokens[i : i+n], alternatives: append(alternatives, rule.to...)})
+		i += n
+	}
+	return slots
+}
+
+// addSynonyms returns tokens with synonyms added. The words of a synonym start at the
+// position of the tokens they replace and span their offsets, so phrases of the original
+// words still match. Phrases containing a synonym only match if it has as many words
+// as the tokens it replaces, see SynonymsAtQuery.
+func (m *SynonymMap) addSynonyms(tokens []Token) []Token {
+	r := make([]Token, 0, len(tokens))
+	for _, slot := range m.expand(tokens) {
+		first, last := slot.tokens[0], slot.tokens[len(slot.tokens)-1]
+		for _, words := range slot.alternatives {
+			if equalWords(words, tokenTerms(slot.tokens)) {
+				r = append(r, slot.tokens...)
+				continue
+			}
+			for i, word := range words {
+				r = append(r, Token{Term: word, Start: first.Start, End: last.End, Position: first.Position + i})
+			}
+		}
+	}
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].Position < r[j].Position
+	})
+	setIncrements(r)
+	return r
+}
+
+// NewSynonymFilter returns a filter adding the synonyms of m to tokens, for use
+// in an analyzer applied to documents only. The words of one-way rules are replaced
+// with their synonyms, the words of equivalent rules are stacked with theirs.
+func NewSynonymFilter(m *SynonymMap) TokenFilter {
+	return NamedFilter("synonyms", TokenFilterFunc(m.addSynonyms))
+}
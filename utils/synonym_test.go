@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSynonyms = `
+# Countries
+USA, United States, america
+nyc, big apple => new york
+colour => color
+`
+
+func TestParseSynonyms(t *testing.T) {
+	m, err := ParseSynonyms(strings.NewReader(testSynonyms))
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		tokens []string
+		slots  [][][]string
+	}{
+		{
+			tokens: []string{"usa"},
+			slots:  [][][]string{{{"usa"}, {"united", "states"}, {"america"}}},
+		},
+		{
+			tokens: []string{"the", "united", "states", "army"},
+			slots: [][][]string{
+				{{"the"}},
+				{{"united", "states"}, {"usa"}, {"america"}},
+				{{"army"}},
+			},
+		},
+		{
+			tokens: []string{"big", "apple", "pie"},
+			slots:  [][][]string{{{"new", "york"}}, {{"pie"}}},
+		},
+		{
+			tokens: []string{"united", "kingdom"},
+			slots:  [][][]string{{{"united"}}, {{"kingdom"}}},
+		},
+	}
+	for _, tc := range testCases {
+		var slots [][][]string
+		for _, slot := range m.expand(newTokens(tc.tokens)) {
+			slots = append(slots, slot.alternatives)
+		}
+		assert.Equal(t, tc.slots, slots, tc.tokens)
+	}
+
+	// Synonyms are stacked at the position of the words they replace
+	tokens := m.addSynonyms(newTokens([]string{"big", "usa", "army"}))
+	assert.Equal(t, []string{"big", "usa", "united", "america", "states", "army"}, tokenTerms(tokens))
+	var positions, increments []int
+	for _, token := range tokens {
+		positions, increments = append(positions, token.Position), append(increments, token.PositionIncrement)
+	}
+	assert.Equal(t, []int{0, 1, 1, 1, 2, 2}, positions)
+	assert.Equal(t, []int{1, 1, 0, 0, 1, 0}, increments)
+
+	assert.Equal(t, []string{"big", "new", "york", "color", "red"},
+		tokenTerms(NewSynonymFilter(m).Filter(newTokens([]string{"big", "nyc", "colour", "red"}))))
+
+	for _, invalid := range []string{"lonely", "=> nothing", "nothing =>"} {
+		_, err := ParseSynonyms(strings.NewReader(invalid))
+		assert.ErrorContains(t, err, "line 1", invalid)
+	}
+}
+
+func TestSynonymSearch(t *testing.T) {
+	m, err := ParseSynonyms(strings.NewReader(testSynonyms))
+	assert.NoError(t, err)
+	docs := []*Document{
+		{ID: 1, Text: "The United States declared independence in 1776"},
+		{ID: 2, Text: "The USA declared war"},
+		{ID: 3, Text: "States united in war"},
+		{ID: 4, Text: "The USA is also called the United States"},
+	}
+
+	for _, mode := range []SynonymMode{SynonymsAtQuery, SynonymsAtIndex} {
+		for _, idx := range []Indexer{NewIndex(WithSynonyms(m, mode)), NewConcurrentIndex(WithSynonyms(m, mode))} {
+			idx.Add(docs)
+
+			results := idx.Search("usa")
+			assert.ElementsMatch(t, []int{1, 2, 4}, docIDs(results))
+
+			results = idx.Search(`"united states"`)
+			assert.ElementsMatch(t, []int{1, 2, 4}, docIDs(results), mode)
+
+			// Index-time synonyms of a different length break phrases
+			results = idx.Search(`"usa declared"`)
+			if mode == SynonymsAtQuery {
+				assert.ElementsMatch(t, []int{1, 2}, docIDs(results))
+			} else {
+				assert.ElementsMatch(t, []int{2}, docIDs(results))
+			}
+		}
+	}
+
+	// Document 4 matches both "usa" and "united states", but only the best one counts
+	idx := NewIndex(WithSynonyms(m, SynonymsAtQuery))
+	idx.Add(docs)
+	plain := NewIndex()
+	plain.Add(docs)
+	best := max(scoreOf(plain.Search("usa"), 4), scoreOf(plain.Search(`"united states"`), 4))
+	assert.InDelta(t, best, scoreOf(idx.Search("usa"), 4), 1e-6)
+
+	// Index-time synonyms do not count in the document length, so scores are unchanged
+	expanded := NewIndex(WithSynonyms(m, SynonymsAtIndex))
+	expanded.Add(docs)
+	assert.InDelta(t, scoreOf(plain.Search("declared"), 2), scoreOf(expanded.Search("declared"), 2), 1e-6)
+
+	// Query-time phrases with synonyms match synonyms written in full
+	results := idx.Search(`"usa declared independence"`)
+	assert.Equal(t, []int{1}, docIDs(results))
+}
+
+// docIDs returns the document IDs of results, in order.
+func docIDs(results []SearchResult) []int {
+	ids := make([]int, len(results))
+	for i, result := range results {
+		ids[i] = result.DocID
+	}
+	return ids
+}
+
+// scoreOf returns the score of docID in results, or 0.
+func scoreOf(results []SearchResult, docID int) float32 {
+	for _, result := range results {
+		if result.DocID == docID {
+			return result.Score
+		}
+	}
+	return 0
+}
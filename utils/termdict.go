@@ -0,0 +1,293 @@
+package utils
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// termDict is a sorted term dictionary used to enumerate terms without
+// scanning every key of an index map.
+type termDict struct {
+	terms []string
+}
+
+// newTermDict creates a termDict from the given terms. The slice is sorted in place.
+func newTermDict(terms []string) *termDict {
+	sort.Strings(terms)
+	return &termDict{terms: terms}
+}
+
+// buildTermDict creates a termDict from the given terms like newTermDict, returning
+// ctx.Err() if ctx is done first. Runs of checkInterval terms are sorted then merged,
+// so that sorting a large vocabulary can be interrupted.
+func buildTermDict(ctx context.Context, terms []string) (*termDict, error) {
+	for lo := 0; lo < len(terms); lo += checkInterval {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		sort.Strings(terms[lo:min(lo+checkInterval, len(terms))])
+	}
+
+	buf := make([]string, len(terms))
+	for width := checkInterval; width < len(terms); width *= 2 {
+		for lo := 0; lo < len(terms); lo += 2 * width {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			mid, hi := min(lo+width, len(terms)), min(lo+2*width, len(terms))
+			mergeTerms(buf[lo:hi], terms[lo:mid], terms[mid:hi])
+		}
+		terms, buf = buf, terms
+	}
+	return &termDict{terms: terms}, nil
+}
+
+// mergeTerms merges the sorted terms of a and b into dst.
+func mergeTerms(dst, a, b []string) {
+	i, j := 0, 0
+	for k := range dst {
+		if j == len(b) || (i < len(a) && a[i] <= b[j]) {
+			dst[k] = a[i]
+			i++
+		} else {
+			dst[k] = b[j]
+			j++
+		}
+	}
+}
+
+// lazyDict is a termDict built on first use by one of the searches needing it.
+// A search whose context is done while building it leaves it to the next one.
+type lazyDict struct {
+	mu   sync.Mutex
+	dict *termDict
+}
+
+// get returns the dictionary of the surface forms returned by forms, building it
+// unless it already was.
+func (l *lazyDict) get(ctx context.Context, forms func() map[string]int) (*termDict, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.dict != nil {
+		return l.dict, nil
+	}
+	m := forms()
+	terms := make([]string, 0, len(m))
+	for form := range m {
+		terms = append(terms, form)
+	}
+	dict, err := buildTermDict(ctx, terms)
+	if err != nil {
+		return nil, err
+	}
+	l.dict = dict
+	return dict, nil
+}
+
+// fuzzyMatch is a dictionary term within a bounded edit distance of a query term.
+type fuzzyMatch struct {
+	Term     string
+	Distance int
+}
+
+// fuzzy returns all terms within maxDist edits of term. Edits are insertions,
+// deletions, substitutions and transpositions of adjacent characters.
+//
+// Terms are walked in sorted order, so the distance rows of a prefix shared with
+// the previous term are computed only once. As soon as no extension of a prefix
+// can be within maxDist, the whole range of terms starting with it is skipped.
+// ctx is checked every checkInterval terms, returning ctx.Err() once it is done.
+func (d *termDict) fuzzy(ctx context.Context, term string, maxDist int) ([]fuzzyMatch, error) {
+	query := []rune(term)
+	m := len(query)
+
+	// rows[k] holds the distances between the first k runes of the current
+	// dictionary term and every prefix of the query.
+	first := make([]int, m+1)
+	for j := range first {
+		first[j] = j
+	}
+	rows := [][]int{first}
+	runes := []rune{} // runes of the current term
+	ends := []int{0}  // ends[k] is the byte offset just after the k-th rune
+	prev := ""
+
+	var matches []fuzzyMatch
+	for i, checked := 0, 0; i < len(d.terms); checked++ {
+		if checked%checkInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		t := d.terms[i]
+
+		// Keep the rows of the rune-aligned prefix shared with the previous term
+		lcp := commonPrefixLen(prev, t)
+		depth := 0
+		for depth+1 < len(ends) && ends[depth+1] <= lcp {
+			depth++
+		}
+		rows, runes, ends = rows[:depth+1], runes[:depth], ends[:depth+1]
+		prev = t
+
+		pruned := false
+		for off := ends[depth]; off < len(t); {
+			r, size := utf8.DecodeRuneInString(t[off:])
+			off += size
+			runes = append(runes, r)
+			ends = append(ends, off)
+
+			row, best := nextDistanceRow(rows, runes, query)
+			rows = append(rows, row)
+			if best > maxDist {
+				// No term starting with this prefix can match, skip them all
+				i = d.prefixEnd(t[:off])
+				pruned = true
+				break
+			}
+		}
+		if pruned {
+			continue
+		}
+
+		if dist := rows[len(rows)-1][m]; dist <= maxDist {
+			matches = append(matches, fuzzyMatch{Term: t, Distance: dist})
+		}
+		i++
+	}
+	return matches, nil
+}
+
+// prefixEnd returns the index of the first term after all terms starting with prefix.
+func (d *termDict) prefixEnd(prefix string) int {
+	return sort.Search(len(d.terms), func(i int) bool {
+		return d.terms[i] > prefix && !strings.HasPrefix(d.terms[i], prefix)
+	})
+}
+
+// nextDistanceRow computes the edit distance row for the last rune in runes,
+// given the rows of all shorter prefixes. It also returns the row minimum.
+func nextDistanceRow(rows [][]int, runes []rune, query []rune) ([]int, int) {
+	k := len(runes)
+	c := runes[k-1]
+	above := rows[k-1]
+	row := make([]int, len(query)+1)
+	row[0] = k
+	best := k
+	for j := 1; j <= len(query); j++ {
+		cost := 1
+		if query[j-1] == c {
+			cost = 0
+		}
+		v := min(above[j]+1, row[j-1]+1, above[j-1]+cost)
+		// Transposition of two adjacent characters counts as a single edit
+		if k > 1 && j > 1 && c == query[j-2] && runes[k-2] == query[j-1] {
+			v = min(v, rows[k-2][j-2]+1)
+		}
+		row[j] = v
+		best = min(best, v)
+	}
+	return row, best
+}
+
+// commonPrefixLen returns the length in bytes of the common prefix of a and b.
+func commonPrefixLen(a, b string) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// withPrefix returns the terms starting with prefix.
+func (d *termDict) withPrefix(prefix string) []string {
+	lo := sort.SearchStrings(d.terms, prefix)
+	return d.terms[lo:d.prefixEnd(prefix)]
+}
+
+// between returns the terms sorting between lower and upper. An empty bound is open.
+func (d *termDict) between(lower, upper string, includeLower, includeUpper bool) []string {
+	lo := 0
+	if lower != "" {
+		lo = sort.Search(len(d.terms), func(i int) bool {
+			if includeLower {
+				return d.terms[i] >= lower
+			}
+			return d.terms[i] > lower
+		})
+	}
+	hi := len(d.terms)
+	if upper != "" {
+		hi = sort.Search(len(d.terms), func(i int) bool {
+			if includeUpper {
+				return d.terms[i] > upper
+			}
+			return d.terms[i] >= upper
+		})
+	}
+	if lo >= hi {
+		return nil
+	}
+	return d.terms[lo:hi]
+}
+
+// wildcard returns the terms matching pattern, where '*' matches any sequence of
+// characters and '?' matches a single character. Only the terms starting with the
+// literal prefix of the pattern are tested. At most limit+1 terms are returned,
+// so callers can tell when the limit is exceeded. ctx is checked every checkInterval
+// terms, returning ctx.Err() once it is done.
+func (d *termDict) wildcard(ctx context.Context, pattern string, limit int) ([]string, error) {
+	prefix := pattern
+	if i := strings.IndexAny(pattern, "*?"); i >= 0 {
+		prefix = pattern[:i]
+	}
+
+	var matches []string
+	for i, term := range d.withPrefix(prefix) {
+		if i%checkInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if matchWildcard(pattern, term) {
+			matches = append(matches, term)
+			if len(matches) > limit {
+				break
+			}
+		}
+	}
+	return matches, nil
+}
+
+// matchWildcard reports whether s matches pattern, where '*' matches any
+// sequence of characters and '?' matches a single character.
+func matchWildcard(pattern, s string) bool {
+	p, t := []rune(pattern), []rune(s)
+	pi, ti := 0, 0
+	star, mark := -1, 0 // position of the last '*' and of the text it was matched against
+	for ti < len(t) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == t[ti]):
+			pi++
+			ti++
+		case pi < len(p) && p[pi] == '*':
+			star, mark = pi, ti
+			pi++
+		case star >= 0:
+			// Let the last '*' absorb one more character and retry
+			mark++
+			pi, ti = star+1, mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
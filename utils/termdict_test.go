@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTermDictFuzzy(t *testing.T) {
+	dict := newTermDict([]string{"einstein", "eine", "stein", "einsteinium", "zürich", "zurich", "apple", "apply", "ample"})
+
+	testCases := []struct {
+		name    string
+		term    string
+		maxDist int
+		matches []fuzzyMatch
+	}{
+		{
+			name:    "Exact match",
+			term:    "stein",
+			maxDist: 0,
+			matches: []fuzzyMatch{{Term: "stein", Distance: 0}},
+		},
+		{
+			name:    "Transposition is a single edit",
+			term:    "einstien",
+			maxDist: 1,
+			matches: []fuzzyMatch{{Term: "einstein", Distance: 1}},
+		},
+		{
+			name:    "Substitution and deletion",
+			term:    "appel",
+			maxDist: 2,
+			matches: []fuzzyMatch{{Term: "ample", Distance: 2}, {Term: "apple", Distance: 1}, {Term: "apply", Distance: 2}},
+		},
+		{
+			name:    "Multi-byte runes count as one edit",
+			term:    "zurich",
+			maxDist: 1,
+			matches: []fuzzyMatch{{Term: "zurich", Distance: 0}, {Term: "zürich", Distance: 1}},
+		},
+		{
+			name:    "No match",
+			term:    "quantum",
+			maxDist: 2,
+			matches: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			matches, err := dict.fuzzy(context.Background(), tc.term, tc.maxDist)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.matches, matches)
+		})
+	}
+}
+
+func TestTermDictEnumeration(t *testing.T) {
+	dict := newTermDict([]string{"quantum", "quantity", "quark", "test", "text", "tent", "toast", "zebra"})
+
+	assert.Equal(t, []string{"quantity", "quantum"}, dict.withPrefix("quant"))
+	assert.Equal(t, []string{"quantity", "quantum", "quark"}, dict.withPrefix("qua"))
+	assert.Empty(t, dict.withPrefix("quo"))
+	assert.Len(t, dict.withPrefix(""), 8)
+
+	assert.Equal(t, []string{"tent", "test", "text"}, wildcard(t, dict, "te?t", 10))
+	assert.Equal(t, []string{"test", "toast"}, wildcard(t, dict, "t*st", 10))
+	assert.Equal(t, []string{"quantity", "quantum"}, wildcard(t, dict, "*ant*", 10))
+	// At most limit+1 terms are returned
+	assert.Len(t, wildcard(t, dict, "*", 2), 3)
+
+	assert.Equal(t, []string{"tent", "test", "text"}, dict.between("tent", "text", true, true))
+	assert.Equal(t, []string{"test"}, dict.between("tent", "text", false, false))
+	assert.Equal(t, []string{"toast", "zebra"}, dict.between("text", "", false, true))
+	assert.Equal(t, []string{"quantity", "quantum"}, dict.between("", "quark", true, false))
+	assert.Empty(t, dict.between("z", "a", true, true))
+}
+
+func TestMatchWildcard(t *testing.T) {
+	assert.True(t, matchWildcard("te?t", "test"))
+	assert.False(t, matchWildcard("te?t", "tet"))
+	assert.True(t, matchWildcard("*", ""))
+	assert.True(t, matchWildcard("a*b*c", "aXXbYYc"))
+	assert.False(t, matchWildcard("a*b*c", "aXXbYY"))
+	assert.True(t, matchWildcard("z?rich", "zürich"))
+	assert.True(t, matchWildcard("**x", "abx"))
+}
+
+// wildcard returns the terms of dict matching pattern, see termDict.wildcard.
+func wildcard(t *testing.T, dict *termDict, pattern string, limit int) []string {
+	matches, err := dict.wildcard(context.Background(), pattern, limit)
+	assert.NoError(t, err)
+	return matches
+}
+
+func TestBuildTermDict(t *testing.T) {
+	terms := make([]string, 5*checkInterval+7)
+	for i := range terms {
+		terms[i] = fmt.Sprintf("t%d", (i*7919)%len(terms))
+	}
+	want := append([]string(nil), terms...)
+	sort.Strings(want)
+
+	dict, err := buildTermDict(context.Background(), append([]string(nil), terms...))
+	assert.NoError(t, err)
+	assert.Equal(t, want, dict.terms)
+
+	// Building and enumerating stop once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = buildTermDict(ctx, terms)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = dict.fuzzy(ctx, "t1", 1)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = dict.wildcard(ctx, "t*", 10)
+	assert.ErrorIs(t, err, context.Canceled)
+}
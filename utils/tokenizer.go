@@ -1,24 +1,270 @@
 package utils
 
 import (
+	"regexp"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
-// tokenize returns a slice of tokens for the given text.
-func tokenize(text string) []string {
-	return strings.FieldsFunc(text, func(r rune) bool {
-		// Split on any character that is not a letter or a number.
-		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+// bigramScripts are scripts written without spaces between words. Words in these
+// scripts cannot be told apart without a dictionary, so they are indexed as
+// overlapping pairs of characters instead.
+var bigramScripts = []*unicode.RangeTable{
+	unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul,
+	unicode.Thai, unicode.Lao, unicode.Khmer, unicode.Myanmar,
+}
+
+// tokenize returns a slice of tokens for the given text, at consecutive positions.
+// Runs of characters in bigramScripts become overlapping bigrams, so "東京都"
+// yields "東京" and "京都".
+func tokenize(text string) []Token {
+	tokens := make([]Token, 0, len(text)/6)
+	// Split on any character that is not part of a word
+	start := -1
+	for i, r := range text {
+		switch {
+		case isWordRune(r):
+			if start < 0 {
+				start = i
+			}
+		case start >= 0:
+			tokens = appendWordTokens(tokens, text, start, i)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = appendWordTokens(tokens, text, start, len(text))
+	}
+	return tokens
+}
+
+// appendWordTokens appends the tokens of the word text[start:end] to tokens. The word
+// is split where it switches between bigram and other scripts, e.g. "2024年" yields
+// "2024" and "年".
+func appendWordTokens(tokens []Token, text string, start, end int) []Token {
+	runStart := start
+	bigram := false
+	var chars []int // offsets of the characters of a bigram run
+	for i, r := range text[start:end] {
+		i += start
+		if i > start && isCombining(r) {
+			// Part of the previous character
+			continue
+		}
+		isBigram := unicode.In(r, bigramScripts...)
+		if i > start && isBigram != bigram {
+			tokens = appendRunTokens(tokens, text, runStart, i, chars)
+			runStart, chars = i, chars[:0]
+		}
+		bigram = isBigram
+		if bigram {
+			chars = append(chars, i)
+		}
+	}
+	return appendRunTokens(tokens, text, runStart, end, chars)
+}
+
+// appendRunTokens appends the tokens of the run of characters text[start:end] to
+// tokens: the run itself, or the bigrams of a run in a bigram script whose characters
+// start at offsets chars.
+func appendRunTokens(tokens []Token, text string, start, end int, chars []int) []Token {
+	if len(chars) < 2 {
+		return appendToken(tokens, text, start, end)
+	}
+	for i := 0; i+1 < len(chars); i++ {
+		bigramEnd := end
+		if i+2 < len(chars) {
+			bigramEnd = chars[i+2]
+		}
+		tokens = appendToken(tokens, text, chars[i], bigramEnd)
+	}
+	return tokens
+}
+
+// appendToken appends text[start:end] to tokens, at the position following the last one.
+func appendToken(tokens []Token, text string, start, end int) []Token {
+	return append(tokens, Token{
+		Term:              text[start:end],
+		Start:             start,
+		End:               end,
+		Position:          nextPosition(tokens),
+		PositionIncrement: 1,
 	})
 }
 
-// analyze analyzes the text and returns a slice of tokens.
-func analyze(text string) []string {
-	tokens := tokenize(text)
-	tokens = characterFilter(tokens)
-	tokens = lowercaseFilter(tokens)
-	tokens = stopwordFilter(tokens)
-	tokens = stemmerFilter(tokens)
+// nextPosition returns the position following the last of tokens.
+func nextPosition(tokens []Token) int {
+	if len(tokens) == 0 {
+		return 0
+	}
+	return tokens[len(tokens)-1].Position + 1
+}
+
+var (
+	urlPattern   = regexp.MustCompile(`^(?i)(?:(?:https?|ftp)://|www\.)[^\s<>"'(){}\[\]]+`)
+	emailPattern = regexp.MustCompile(`^[\p{L}\p{N}._%+-]+@[\p{L}\p{N}-]+(?:\.[\p{L}\p{N}-]+)+`)
+)
+
+// entityTokenizer implements the tokenizers returned by NewEntityTokenizer.
+type entityTokenizer struct {
+	withParts bool
+}
+
+// NewEntityTokenizer returns a tokenizer splitting text like StandardTokenizer, except
+// that URLs, email addresses, numbers such as "3.14", words joined by hyphens, periods,
+// apostrophes or underscores and names such as "C++" or "C#" are kept as single tokens,
+// following rules similar to the Unicode word boundaries of UAX #29.
+//
+// If withParts is set, the words of URLs, email addresses and hyphenated words follow
+// them, the first one stacked at the position of the whole token, so that "e-mail"
+// also matches "mail".
+func NewEntityTokenizer(withParts bool) Tokenizer {
+	return &entityTokenizer{withParts: withParts}
+}
+
+func (t *entityTokenizer) String() string {
+	if t.withParts {
+		return "entity tokenizer with parts"
+	}
+	return "entity tokenizer"
+}
+
+// Tokenize returns the tokens of text.
+func (t *entityTokenizer) Tokenize(text string) []Token {
+	tokens := make([]Token, 0, len(text)/6)
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if !isWordRune(r) {
+			i += size
+			continue
+		}
+		end, typ := scanEntity(text, i)
+		if typ == WordToken {
+			tokens = appendWordTokens(tokens, text, i, end)
+		} else {
+			tokens = t.appendEntity(tokens, text, i, end, typ)
+		}
+		i = end
+	}
+	return tokens
+}
+
+// appendEntity appends the token text[start:end] of type typ to tokens, followed by
+// its words if the tokenizer emits them.
+func (t *entityTokenizer) appendEntity(tokens []Token, text string, start, end int, typ TokenType) []Token {
+	position := nextPosition(tokens)
+	tokens = append(tokens, Token{
+		Term:              text[start:end],
+		Start:             start,
+		End:               end,
+		Position:          position,
+		PositionIncrement: 1,
+		Type:              typ,
+	})
+	if !t.withParts || typ == NumberToken || typ == SymbolToken {
+		return tokens
+	}
+
+	for i, part := range tokenize(text[start:end]) {
+		part.Start += start
+		part.End += start
+		part.Position += position
+		part.PositionIncrement = min(i, 1)
+		tokens = append(tokens, part)
+	}
 	return tokens
 }
+
+// scanEntity returns the end and type of the token starting at text[start],
+// which is a word rune.
+func scanEntity(text string, start int) (int, TokenType) {
+	rest := text[start:]
+	if m := urlPattern.FindStringIndex(rest); m != nil {
+		// Punctuation ending a URL most likely ends the sentence instead
+		return start + len(strings.TrimRight(rest[:m[1]], ".,;:!?")), URLToken
+	}
+	if m := emailPattern.FindStringIndex(rest); m != nil {
+		return start + m[1], EmailToken
+	}
+
+	end, typ := start, WordToken
+	separated := false
+	for {
+		for end < len(text) {
+			r, size := utf8.DecodeRuneInString(text[end:])
+			if !isWordRune(r) {
+				break
+			}
+			end += size
+		}
+		prev, _ := utf8.DecodeLastRuneInString(text[:end])
+		r, size := utf8.DecodeRuneInString(text[end:])
+		next, _ := utf8.DecodeRuneInString(text[min(end+size, len(text)):])
+		if end == len(text) || !joinsWords(prev, r, next) {
+			break
+		}
+		if r == '-' {
+			typ = HyphenatedToken
+		}
+		separated = separated || r == '.' || r == ','
+		end += size
+	}
+
+	word := text[start:end]
+	switch {
+	case typ == HyphenatedToken:
+		return end, typ
+	case separated && strings.TrimFunc(word, func(r rune) bool { return unicode.IsDigit(r) || r == '.' || r == ',' }) == "":
+		return end, NumberToken
+	}
+
+	// Names such as "C++" or "C#"
+	last, _ := utf8.DecodeLastRuneInString(word)
+	if unicode.IsLetter(last) {
+		for _, suffix := range []string{"++", "+", "#"} {
+			after, _ := utf8.DecodeRuneInString(text[min(end+len(suffix), len(text)):])
+			if strings.HasPrefix(text[end:], suffix) && (end+len(suffix) == len(text) || !isWordRune(after)) {
+				return end + len(suffix), SymbolToken
+			}
+		}
+	}
+	return end, WordToken
+}
+
+// joinsWords reports whether r, between the runes prev and next, joins them into a
+// single token: hyphens and underscores join words, periods and apostrophes join
+// letters, and periods and commas join digits.
+func joinsWords(prev, r, next rune) bool {
+	if !isWordRune(next) || unicode.In(prev, bigramScripts...) || unicode.In(next, bigramScripts...) {
+		return false
+	}
+	switch r {
+	case '-', '_':
+		return true
+	case '.', '\'', '’':
+		return (unicode.IsLetter(prev) && unicode.IsLetter(next)) ||
+			(r == '.' && unicode.IsDigit(prev) && unicode.IsDigit(next))
+	case ',':
+		return unicode.IsDigit(prev) && unicode.IsDigit(next)
+	}
+	return false
+}
+
+// isWordRune reports whether r is part of a word, using the same rule as tokenize.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r)
+}
+
+// isCombining reports whether r belongs with the character before it, such as
+// a combining mark or the Japanese prolonged sound mark "ー".
+func isCombining(r rune) bool {
+	return unicode.IsMark(r) || (unicode.Is(unicode.Lm, r) && unicode.Is(unicode.Common, r))
+}
+
+// isSingleCharacterWord reports whether token is a single character carrying
+// meaning on its own, as ideographs do.
+func isSingleCharacterWord(token string) bool {
+	r, size := utf8.DecodeRuneInString(token)
+	return size == len(token) && unicode.In(r, bigramScripts...)
+}
@@ -23,11 +23,93 @@ func TestTokenizer(t *testing.T) {
 			text:   "small wild,cat!",
 			tokens: []string{"small", "wild", "cat"},
 		},
+		{
+			text:   "東京都に住む",
+			tokens: []string{"東京", "京都", "都に", "に住", "住む"},
+		},
+		{
+			text:   "2024年 iPhone用",
+			tokens: []string{"2024", "年", "iPhone", "用"},
+		},
+		{
+			text:   "コーヒー牛乳",
+			tokens: []string{"コーヒー", "ヒー牛", "牛乳"},
+		},
+		{
+			text:   "ภาษาไทย",
+			tokens: []string{"ภา", "าษ", "ษา", "าไ", "ไท", "ทย"},
+		},
+		{
+			text:   "café",
+			tokens: []string{"café"},
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.text, func(st *testing.T) {
-			assert.EqualValues(st, tc.tokens, tokenize(tc.text))
+			assert.EqualValues(st, tc.tokens, tokenTerms(tokenize(tc.text)))
 		})
 	}
 }
+
+func TestTokenizerOffsets(t *testing.T) {
+	assert.Equal(t, []Token{
+		{Term: "café", Start: 0, End: 5, Position: 0, PositionIncrement: 1},
+		{Term: "東京", Start: 7, End: 13, Position: 1, PositionIncrement: 1},
+		{Term: "京都", Start: 10, End: 16, Position: 2, PositionIncrement: 1},
+		{Term: "2024", Start: 16, End: 20, Position: 3, PositionIncrement: 1},
+	}, tokenize("café, 東京都2024"))
+}
+
+func TestEntityTokenizer(t *testing.T) {
+	testCases := []struct {
+		text   string
+		tokens []string
+		types  []TokenType
+	}{
+		{
+			text:   "e-mail C++ and C# 3.14 1,000",
+			tokens: []string{"e-mail", "C++", "and", "C#", "3.14", "1,000"},
+			types:  []TokenType{HyphenatedToken, SymbolToken, WordToken, SymbolToken, NumberToken, NumberToken},
+		},
+		{
+			text:   "See https://go.dev/doc/install. Or write to user@example.com!",
+			tokens: []string{"See", "https://go.dev/doc/install", "Or", "write", "to", "user@example.com"},
+			types:  []TokenType{WordToken, URLToken, WordToken, WordToken, WordToken, EmailToken},
+		},
+		{
+			text:   "version2.0 don't snake_case U.S.A.",
+			tokens: []string{"version2.0", "don't", "snake_case", "U.S.A"},
+			types:  []TokenType{WordToken, WordToken, WordToken, WordToken},
+		},
+		{
+			text:   "東京都-大阪",
+			tokens: []string{"東京", "京都", "大阪"},
+			types:  []TokenType{WordToken, WordToken, WordToken},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.text, func(st *testing.T) {
+			tokens := EntityTokenizer.Tokenize(tc.text)
+			assert.Equal(st, tc.tokens, tokenTerms(tokens))
+			var types []TokenType
+			for _, token := range tokens {
+				types = append(types, token.Type)
+			}
+			assert.Equal(st, tc.types, types)
+		})
+	}
+
+	// Parts follow the whole token, the first one at the same position
+	assert.Equal(t, []Token{
+		{Term: "e-mail", Start: 0, End: 6, Position: 0, PositionIncrement: 1, Type: HyphenatedToken},
+		{Term: "e", Start: 0, End: 1, Position: 0, PositionIncrement: 0},
+		{Term: "mail", Start: 2, End: 6, Position: 1, PositionIncrement: 1},
+		{Term: "a@b.io", Start: 7, End: 13, Position: 2, PositionIncrement: 1, Type: EmailToken},
+		{Term: "a", Start: 7, End: 8, Position: 2, PositionIncrement: 0},
+		{Term: "b", Start: 9, End: 10, Position: 3, PositionIncrement: 1},
+		{Term: "io", Start: 11, End: 13, Position: 4, PositionIncrement: 1},
+		{Term: "now", Start: 14, End: 17, Position: 5, PositionIncrement: 1},
+	}, NewEntityTokenizer(true).Tokenize("e-mail a@b.io now"))
+}